@@ -0,0 +1,70 @@
+package annotate
+
+// BorderMode determines the value of pixels outside of an image when a kernel overlaps the border.
+type BorderMode string
+
+// Border modes, illustrated for a row abcd.
+const (
+	// BorderZero pads with zeros: 00|abcd|00
+	BorderZero BorderMode = "zero"
+	// BorderReplicate repeats the border pixel: aa|abcd|dd
+	BorderReplicate BorderMode = "replicate"
+	// BorderReflect mirrors the image around the border pixel: cb|abcd|cb
+	BorderReflect BorderMode = "reflect"
+	// BorderWrap tiles the image: cd|abcd|ab
+	BorderWrap BorderMode = "wrap"
+)
+
+// resolveBorder validates a border mode, the empty mode of zero-value options means BorderZero.
+func resolveBorder(mode BorderMode) (BorderMode, error) {
+	switch mode {
+	case "":
+		return BorderZero, nil
+	case BorderZero, BorderReplicate, BorderReflect, BorderWrap:
+		return mode, nil
+	default:
+		return "", newParameterError("border", mode, "must be zero, replicate, reflect or wrap")
+	}
+}
+
+// borderIndex maps an index that may be out of bound onto [0, n) according to the border mode. It
+// returns false when the index does not map onto any pixel, which is the case for BorderZero.
+func borderIndex(idx, n int, mode BorderMode) (int, bool) {
+	if 0 <= idx && idx < n {
+		return idx, true
+	}
+
+	switch mode {
+	case BorderReplicate:
+		if idx < 0 {
+			return 0, true
+		}
+
+		return n - 1, true
+	case BorderReflect:
+		if n == 1 {
+			return 0, true
+		}
+
+		period := 2 * (n - 1)
+		idx %= period
+		if idx < 0 {
+			idx += period
+		}
+
+		if idx >= n {
+			idx = period - idx
+		}
+
+		return idx, true
+	case BorderWrap:
+		idx %= n
+		if idx < 0 {
+			idx += n
+		}
+
+		return idx, true
+	default:
+		return 0, false
+	}
+}
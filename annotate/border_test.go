@@ -0,0 +1,101 @@
+package annotate
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBorderIndex(t *testing.T) {
+	// Row abcd padded by two pixels on each side.
+	expected := map[BorderMode][]int{
+		BorderReplicate: {0, 0, 0, 1, 2, 3, 3, 3},
+		BorderReflect:   {2, 1, 0, 1, 2, 3, 2, 1},
+		BorderWrap:      {2, 3, 0, 1, 2, 3, 0, 1},
+	}
+
+	for mode, indices := range expected {
+		for k, idx := range indices {
+			result, ok := borderIndex(k-2, 4, mode)
+			if !ok || result != idx {
+				t.Errorf("%s: expected index %d to map onto %d, got %d", mode, k-2, idx, result)
+			}
+		}
+	}
+
+	if _, ok := borderIndex(-1, 4, BorderZero); ok {
+		t.Error("expected zero border to have no pixel outside of the image")
+	}
+}
+
+func TestBorderModesOnUniformImage(t *testing.T) {
+	mat := onesGrid(12, 9)
+	kernel1D, _ := NewGaussianKernel1D(5, 1)
+
+	for _, mode := range []BorderMode{BorderReplicate, BorderReflect, BorderWrap} {
+		blurs := map[string]func() (*Grid, error){
+			"GaussianMask":                  func() (*Grid, error) { return GaussianMask(mat, mode) },
+			"ParallelGaussianMask":          func() (*Grid, error) { return ParallelGaussianMask(mat, 4, mode) },
+			"ParallelSeparableGaussianMask": func() (*Grid, error) { return ParallelSeparableGaussianMask(mat, kernel1D, 4, mode) },
+		}
+
+		for name, blur := range blurs {
+			blurred, err := blur()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for idx, val := range blurred.Values {
+				if math.Abs(val-1) > 1e-12 {
+					t.Fatalf("%s with %s border darkens pixel %d to %f", name, mode, idx, val)
+				}
+			}
+		}
+
+		gradients := map[string]func() (*GradientField, error){
+			"GradientMask":                  func() (*GradientField, error) { return GradientMask(mat, mode) },
+			"ParallelGradientMask":          func() (*GradientField, error) { return ParallelGradientMask(mat, 4, mode) },
+			"ParallelSeparableGradientMask": func() (*GradientField, error) { return ParallelSeparableGradientMask(mat, 4, mode) },
+		}
+
+		for name, gradient := range gradients {
+			grads, err := gradient()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < grads.Height; i++ {
+				for j := 0; j < grads.Width; j++ {
+					if grads.Magnitude(i, j) > 1e-12 {
+						t.Fatalf("%s with %s border has artificial edge at (%d, %d)", name, mode, i, j)
+					}
+				}
+			}
+		}
+	}
+
+	t.Run("ZeroBorderHasEdgeFrame", func(t *testing.T) {
+		grads, _ := GradientMask(mat, BorderZero)
+		if grads.Magnitude(0, 4) == 0 || grads.Magnitude(6, 4) != 0 {
+			t.Error("expected zero border to produce edges along the border only")
+		}
+
+		// Zero-value options leave the border mode empty, which means BorderZero.
+		defaults, err := GradientMask(mat, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for idx := range grads.X {
+			if defaults.X[idx] != grads.X[idx] || defaults.Y[idx] != grads.Y[idx] {
+				t.Fatalf("expected empty border mode to match zero border at (%d, %d)", idx/mat.Width,
+					idx%mat.Width)
+			}
+		}
+	})
+
+	t.Run("InvalidMode", func(t *testing.T) {
+		if _, err := GaussianMask(mat, "mirror"); err == nil {
+			t.Error("expected unknown border mode to fail")
+		}
+	})
+}
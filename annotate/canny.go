@@ -0,0 +1,180 @@
+package annotate
+
+import (
+	"math"
+	"sort"
+)
+
+// Edge threshold modes
+const (
+	// ThresholdSingle keeps every local maximum above a single threshold.
+	ThresholdSingle = "single"
+	// ThresholdHysteresis keeps strong local maxima above the high threshold and weak local maxima
+	// above the low threshold only when they are connected to a strong one.
+	ThresholdHysteresis = "hysteresis"
+	// ThresholdAutoMedian applies hysteresis with thresholds derived from MedianThresholds.
+	ThresholdAutoMedian = "auto-median"
+	// ThresholdAutoOtsu applies hysteresis with thresholds derived from OtsuThresholds.
+	ThresholdAutoOtsu = "auto-otsu"
+)
+
+// MinEdgeMagnitude is the smallest gradient magnitude that is taken into account when deriving
+// thresholds automatically. Flat regions of a map, which make up most of it, have a magnitude that
+// is zero up to rounding errors and would otherwise dominate the distribution.
+const MinEdgeMagnitude = 1.0
+
+// otsuBins is the number of histogram bins used by Otsu's method.
+const otsuBins = 256
+
+// HysteresisThreshold is the double threshold stage of Canny's edge detection and it is meant to run
+// after NonMaximumSuppression. Local maxima with magnitude greater than high are strong edges, and
+// local maxima with magnitude greater than low are weak edges. Weak edges are kept only if they are
+// connected to a strong edge through other weak edges in any of the eight directions. Every other
+// gradient is no longer a local maximum.
+func HysteresisThreshold(field *GradientField, low, high float64) error {
+	if err := validateGradientField(field); err != nil {
+		return err
+	}
+
+	if low < 0 {
+		return newParameterError("low", low, "must not be negative")
+	}
+
+	if high < low {
+		return newParameterError("high", high, "must not be less than low")
+	}
+
+	visitRecord := make([]bool, field.Width*field.Height)
+	isWeak := func(idx int) bool {
+		return field.IsLocalMax[idx] && field.magnitude(idx) > low
+	}
+
+	stack := []Coordinate{}
+	for i := 0; i < field.Height; i++ {
+		for j := 0; j < field.Width; j++ {
+			idx := i*field.Width + j
+			if visitRecord[idx] || !isWeak(idx) || field.magnitude(idx) <= high {
+				continue
+			}
+
+			visitRecord[idx] = true
+			stack = append(stack, Coordinate{i, j})
+			for len(stack) > 0 {
+				c := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				for y := c.I - 1; y <= c.I+1; y++ {
+					for x := c.J - 1; x <= c.J+1; x++ {
+						if !field.InBound(y, x) {
+							continue
+						}
+
+						neighbor := y*field.Width + x
+						if visitRecord[neighbor] || !isWeak(neighbor) {
+							continue
+						}
+
+						visitRecord[neighbor] = true
+						stack = append(stack, Coordinate{y, x})
+					}
+				}
+			}
+		}
+	}
+
+	copy(field.IsLocalMax, visitRecord)
+	return nil
+}
+
+// MedianThresholds derives hysteresis thresholds from the median m of gradient magnitudes. The
+// thresholds are (1 - sigma) * m and (1 + sigma) * m, a sigma of 0.33 is a common choice. An image
+// without edges, such as a blank map, gets both thresholds at MinEdgeMagnitude so that no pixel is
+// an edge.
+func MedianThresholds(field *GradientField, sigma float64) (low, high float64, err error) {
+	if sigma < 0 || sigma > 1 {
+		return 0, 0, newParameterError("sigma", sigma, "must be between 0 and 1")
+	}
+
+	magnitudes, err := edgeMagnitudes(field)
+	if err != nil || len(magnitudes) == 0 {
+		return MinEdgeMagnitude, MinEdgeMagnitude, err
+	}
+
+	sort.Float64s(magnitudes)
+	var median float64
+	if n := len(magnitudes); n%2 == 1 {
+		median = magnitudes[n/2]
+	} else {
+		median = (magnitudes[n/2-1] + magnitudes[n/2]) / 2
+	}
+
+	return (1 - sigma) * median, (1 + sigma) * median, nil
+}
+
+// OtsuThresholds derives hysteresis thresholds with Otsu's method. The gradient magnitudes are
+// binned into a histogram and the high threshold is the one that maximizes the variance between the
+// two resulting classes. The low threshold is half of the high threshold. An image without edges gets
+// both thresholds at MinEdgeMagnitude like in MedianThresholds.
+func OtsuThresholds(field *GradientField) (low, high float64, err error) {
+	magnitudes, err := edgeMagnitudes(field)
+	if err != nil || len(magnitudes) == 0 {
+		return MinEdgeMagnitude, MinEdgeMagnitude, err
+	}
+
+	var maxMag float64
+	for _, mag := range magnitudes {
+		maxMag = math.Max(maxMag, mag)
+	}
+
+	binWidth := maxMag / otsuBins
+	histogram := make([]float64, otsuBins)
+	for _, mag := range magnitudes {
+		bin := int(mag / binWidth)
+		if bin >= otsuBins {
+			bin = otsuBins - 1
+		}
+		histogram[bin]++
+	}
+
+	var total, weightedTotal float64
+	for bin, count := range histogram {
+		total += count
+		weightedTotal += float64(bin) * count
+	}
+
+	var background, weightedBackground, maxVariance float64
+	threshold := otsuBins - 1
+	for bin, count := range histogram {
+		background += count
+		weightedBackground += float64(bin) * count
+		foreground := total - background
+		if background == 0 || foreground == 0 {
+			continue
+		}
+
+		meanDiff := weightedBackground/background - (weightedTotal-weightedBackground)/foreground
+		variance := background * foreground * meanDiff * meanDiff
+		if variance > maxVariance {
+			maxVariance = variance
+			threshold = bin
+		}
+	}
+
+	high = float64(threshold+1) * binWidth
+	return high / 2, high, nil
+}
+
+// edgeMagnitudes returns the gradient magnitudes that are at least MinEdgeMagnitude.
+func edgeMagnitudes(field *GradientField) ([]float64, error) {
+	if err := validateGradientField(field); err != nil {
+		return nil, err
+	}
+
+	magnitudes := []float64{}
+	for idx := range field.X {
+		if mag := field.magnitude(idx); mag >= MinEdgeMagnitude {
+			magnitudes = append(magnitudes, mag)
+		}
+	}
+
+	return magnitudes, nil
+}
@@ -0,0 +1,80 @@
+package annotate
+
+import "testing"
+
+func TestHysteresisThreshold(t *testing.T) {
+	// A row of local maxima where a strong edge is connected to weak edges on its right, and an
+	// isolated weak edge sits on the far right.
+	magnitudes := []float64{0, 300, 150, 150, 0, 150, 50}
+	mask := NewGradientField(len(magnitudes), 1)
+	for j, mag := range magnitudes {
+		mask.Set(0, j, Gradient{X: mag, IsLocalMax: mag > 0})
+	}
+
+	if err := HysteresisThreshold(mask, 100, 255); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []bool{false, true, true, true, false, false, false}
+	for j, isLocalMax := range mask.IsLocalMax {
+		if isLocalMax != expected[j] {
+			t.Errorf("expected local max at column %d to be %v", j, expected[j])
+		}
+	}
+
+	if err := HysteresisThreshold(mask, 200, 100); err == nil {
+		t.Error("expected high threshold below low threshold to fail")
+	}
+}
+
+func TestAutoThresholds(t *testing.T) {
+	// Half of the gradients are flat and must be ignored, the rest is a bimodal distribution of weak
+	// noise around 20 and strong edges around 400.
+	mask := NewGradientField(20, 2)
+	for j := 0; j < 10; j++ {
+		mask.Set(0, 2*j, Gradient{X: 0})
+		mask.Set(0, 2*j+1, Gradient{X: 1e-9})
+		mask.Set(1, 2*j, Gradient{X: 20 + float64(j%3)})
+		mask.Set(1, 2*j+1, Gradient{X: 400 + float64(j%3)})
+	}
+
+	t.Run("Median", func(t *testing.T) {
+		low, high, err := MedianThresholds(mask, 0.5)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The median of the 20 edge magnitudes lies between the two modes.
+		if low != 105.5 || high != 316.5 {
+			t.Errorf("expected thresholds 105.5 and 316.5, got %f and %f", low, high)
+		}
+	})
+
+	t.Run("Otsu", func(t *testing.T) {
+		low, high, err := OtsuThresholds(mask)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if high <= 22 || high > 400 || low != high/2 {
+			t.Errorf("expected high threshold to separate the two modes, got %f and %f", low, high)
+		}
+	})
+
+	t.Run("FlatImage", func(t *testing.T) {
+		flat := NewGradientField(2, 1)
+		for _, thresholds := range []func(*GradientField) (float64, float64, error){
+			OtsuThresholds,
+			func(field *GradientField) (float64, float64, error) { return MedianThresholds(field, 0.33) },
+		} {
+			low, high, err := thresholds(flat)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if low != MinEdgeMagnitude || high != MinEdgeMagnitude {
+				t.Errorf("expected flat image thresholds at %f, got %f and %f", MinEdgeMagnitude, low, high)
+			}
+		}
+	})
+}
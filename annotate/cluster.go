@@ -1,51 +1,252 @@
 package annotate
 
+import (
+	"math"
+	"sort"
+)
+
+// Clustering modes
+const (
+	ClusterNearestNeighbor = "nearest-neighbor"
+	ClusterDBSCAN          = "dbscan"
+)
+
+// NoiseClusterID is the cluster ID of edges that DBSCAN does not assign to any cluster. Noise is
+// left out of GroupClusters and therefore of keepout polygons.
+const NoiseClusterID = 0
+
 // SimpleNearestNeighborClustering performs clustering based on concept of connected component. This function will only
-// look at local maximum gradients with magnitude greater than 255. Two selected gradients are considered neighbors if
-// they are within a certain range.
-func SimpleNearestNeighborClustering(gradGrid [][]*Gradient, neighborRange int) {
-	visitRecord := make([][]bool, len(gradGrid))
-	for i := 0; i < len(visitRecord); i++ {
-		visitRecord[i] = make([]bool, len(gradGrid[i]))
-	}
-
-	clusterID := 1
-	for i := 0; i < len(gradGrid); i++ {
-		for j := 0; j < len(gradGrid[i]); j++ {
-			if visitRecord[i][j] {
-				continue
-			}
+// look at local maximum gradients, which are edges that passed the thresholds. Two selected gradients are considered
+// neighbors if they are within a certain range. Cluster IDs start from 1 and are assigned in row-major order of the
+// first edge of every cluster.
+//
+// Edges are merged with a union-find instead of a recursive depth first search, so long walls on large maps cannot
+// exhaust the stack, and every edge only looks at the edges of earlier rows within range instead of the whole window.
+func SimpleNearestNeighborClustering(field *GradientField, neighborRange int) error {
+	if err := validateGradientField(field); err != nil {
+		return err
+	}
+
+	if neighborRange < 1 {
+		return newParameterError("neighborRange", neighborRange, "must be at least 1")
+	}
+
+	index := newEdgeIndex(field)
+	uf := newUnionFind(len(index.cols))
+	for k := range index.cols {
+		index.precedingNeighbors(k, neighborRange, func(n int) {
+			uf.union(n, k)
+		})
+	}
 
-			if gradGrid[i][j].IsLocalMax {
-				gradGrid[i][j].ClusterID = clusterID
-				visitRecord[i][j] = true
-				depthFirstNeighborClusterLabel(i, j, clusterID, neighborRange, gradGrid, visitRecord)
-				clusterID++
+	index.label(field, uf, func(k int) bool { return true })
+	return nil
+}
+
+// DBSCANClustering performs density based clustering of local maximum gradients. An edge is a core edge when at least
+// minPoints edges, itself included, lie within a Euclidean distance of eps. Core edges within eps of each other belong
+// to the same cluster, and the remaining edges within eps of a core edge join the cluster of that core edge, the one
+// with the lowest ID if there are several. Every other edge is noise and gets NoiseClusterID. Cluster IDs start from 1
+// and are assigned in row-major order of the first core edge of every cluster.
+func DBSCANClustering(field *GradientField, eps float64, minPoints int) error {
+	if err := validateGradientField(field); err != nil {
+		return err
+	}
+
+	if eps < 1 {
+		return newParameterError("eps", eps, "must be at least 1")
+	}
+
+	if minPoints < 1 {
+		return newParameterError("minPoints", minPoints, "must be at least 1")
+	}
+
+	index := newEdgeIndex(field)
+
+	// Every edge is its own neighbor, and every pair of neighbors is visited once.
+	numNeighbors := make([]int, len(index.cols))
+	for k := range index.cols {
+		numNeighbors[k]++
+		index.precedingNeighborsWithin(k, eps, func(n int) {
+			numNeighbors[n]++
+			numNeighbors[k]++
+		})
+	}
+
+	isCore := func(k int) bool { return numNeighbors[k] >= minPoints }
+
+	uf := newUnionFind(len(index.cols))
+	for k := range index.cols {
+		if !isCore(k) {
+			continue
+		}
+
+		index.precedingNeighborsWithin(k, eps, func(n int) {
+			if isCore(n) {
+				uf.union(n, k)
 			}
+		})
+	}
+
+	index.label(field, uf, isCore)
+
+	// Border edges join the neighboring core edge cluster with the lowest ID.
+	for k := range index.cols {
+		if isCore(k) {
+			continue
 		}
+
+		clusterID := NoiseClusterID
+		index.neighborsWithin(k, eps, func(n int) {
+			if id := field.ClusterID[index.pixel(n)]; isCore(n) && (clusterID == NoiseClusterID || id < clusterID) {
+				clusterID = id
+			}
+		})
+
+		field.ClusterID[index.pixel(k)] = clusterID
 	}
+
+	return nil
 }
 
-func depthFirstNeighborClusterLabel(y, x, id, neighborRange int, gradGrid [][]*Gradient, visitRecord [][]bool) {
-	for i := y - neighborRange; i <= y+neighborRange; i++ {
-		for j := x - neighborRange; j <= x+neighborRange; j++ {
-			if i < 0 || i >= len(gradGrid) {
-				continue
-			}
+// edgeIndex lists the local maximum gradients in row-major order by row and column, the edges of row i
+// are cols[rowStart[i]:rowStart[i+1]]. Edges are referred to by their position in the list.
+type edgeIndex struct {
+	width    int
+	cols     []int
+	rows     []int
+	rowStart []int
+}
 
-			if j < 0 || j >= len(gradGrid[i]) {
-				continue
+func newEdgeIndex(field *GradientField) *edgeIndex {
+	index := &edgeIndex{width: field.Width, rowStart: make([]int, field.Height+1)}
+	for i := 0; i < field.Height; i++ {
+		index.rowStart[i] = len(index.cols)
+		for j := 0; j < field.Width; j++ {
+			if field.IsLocalMax[i*field.Width+j] {
+				index.cols = append(index.cols, j)
+				index.rows = append(index.rows, i)
 			}
+		}
+	}
+	index.rowStart[field.Height] = len(index.cols)
+
+	return index
+}
 
-			if visitRecord[i][j] {
+// pixel returns the index of edge k in the gradient field.
+func (e *edgeIndex) pixel(k int) int {
+	return e.rows[k]*e.width + e.cols[k]
+}
+
+// precedingNeighbors calls fn with every edge before edge k within neighborRange rows and columns.
+// Neighborhood is symmetric, so visiting preceding edges only covers every pair once.
+func (e *edgeIndex) precedingNeighbors(k, neighborRange int, fn func(n int)) {
+	e.scan(k, neighborRange, true, func(dy int) int { return neighborRange }, fn)
+}
+
+// precedingNeighborsWithin calls fn with every edge before edge k within a Euclidean distance of eps.
+func (e *edgeIndex) precedingNeighborsWithin(k int, eps float64, fn func(n int)) {
+	e.scan(k, int(eps), true, euclideanReach(eps), fn)
+}
+
+// neighborsWithin calls fn with every edge other than edge k within a Euclidean distance of eps.
+func (e *edgeIndex) neighborsWithin(k int, eps float64, fn func(n int)) {
+	e.scan(k, int(eps), false, euclideanReach(eps), fn)
+}
+
+// euclideanReach returns the column reach of a disk of radius eps at a given row offset.
+func euclideanReach(eps float64) func(dy int) int {
+	return func(dy int) int {
+		return int(math.Sqrt(eps*eps - float64(dy*dy)))
+	}
+}
+
+// scan calls fn with every edge other than edge k that lies within rowReach rows and within
+// colReach(dy) columns of edge k, or only with the edges before edge k when preceding is set.
+func (e *edgeIndex) scan(k, rowReach int, preceding bool, colReach func(dy int) int, fn func(n int)) {
+	y, x := e.rows[k], e.cols[k]
+	lastRow := y + rowReach
+	if preceding {
+		lastRow = y
+	}
+
+	for i := y - rowReach; i <= lastRow; i++ {
+		if i < 0 || len(e.rowStart)-1 <= i {
+			continue
+		}
+
+		reach := colReach(i - y)
+		start, end := e.rowStart[i], e.rowStart[i+1]
+		for n := start + sort.SearchInts(e.cols[start:end], x-reach); n < end && e.cols[n] <= x+reach; n++ {
+			if n == k && !preceding {
 				continue
 			}
 
-			if gradGrid[i][j].IsLocalMax {
-				gradGrid[i][j].ClusterID = id
-				visitRecord[i][j] = true
-				depthFirstNeighborClusterLabel(i, j, id, neighborRange, gradGrid, visitRecord)
+			if n >= k && preceding {
+				break
 			}
+
+			fn(n)
 		}
 	}
 }
+
+// label assigns cluster IDs starting from 1 to the sets of a union-find in row-major order of their
+// first edge. Only edges accepted by include are labeled.
+func (e *edgeIndex) label(field *GradientField, uf *unionFind, include func(k int) bool) {
+	clusterIDs := make([]int, len(e.cols))
+	numClusters := 0
+	for k := range e.cols {
+		if !include(k) {
+			continue
+		}
+
+		root := uf.find(k)
+		if clusterIDs[root] == 0 {
+			numClusters++
+			clusterIDs[root] = numClusters
+		}
+
+		field.ClusterID[e.pixel(k)] = clusterIDs[root]
+	}
+}
+
+// unionFind is a disjoint set forest with path halving and union by size.
+type unionFind struct {
+	parent []int
+	size   []int
+}
+
+func newUnionFind(n int) *unionFind {
+	uf := &unionFind{parent: make([]int, n), size: make([]int, n)}
+	for i := range uf.parent {
+		uf.parent[i] = i
+		uf.size[i] = 1
+	}
+
+	return uf
+}
+
+func (uf *unionFind) find(i int) int {
+	for uf.parent[i] != i {
+		uf.parent[i] = uf.parent[uf.parent[i]]
+		i = uf.parent[i]
+	}
+
+	return i
+}
+
+func (uf *unionFind) union(a, b int) {
+	a, b = uf.find(a), uf.find(b)
+	if a == b {
+		return
+	}
+
+	if uf.size[a] < uf.size[b] {
+		a, b = b, a
+	}
+
+	uf.parent[b] = a
+	uf.size[a] += uf.size[b]
+}
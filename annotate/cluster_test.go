@@ -0,0 +1,198 @@
+package annotate
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// recursiveNeighborClustering is the depth first search that SimpleNearestNeighborClustering
+// replaced. It is kept as a reference for correctness and for benchmarks.
+func recursiveNeighborClustering(field *GradientField, neighborRange int) {
+	visitRecord := make([]bool, field.Width*field.Height)
+
+	var label func(y, x, id int)
+	label = func(y, x, id int) {
+		for i := y - neighborRange; i <= y+neighborRange; i++ {
+			for j := x - neighborRange; j <= x+neighborRange; j++ {
+				if !field.InBound(i, j) || visitRecord[i*field.Width+j] || !field.IsLocalMax[i*field.Width+j] {
+					continue
+				}
+
+				field.ClusterID[i*field.Width+j] = id
+				visitRecord[i*field.Width+j] = true
+				label(i, j, id)
+			}
+		}
+	}
+
+	clusterID := 1
+	for idx := range field.IsLocalMax {
+		if visitRecord[idx] || !field.IsLocalMax[idx] {
+			continue
+		}
+
+		field.ClusterID[idx] = clusterID
+		visitRecord[idx] = true
+		label(idx/field.Width, idx%field.Width, clusterID)
+		clusterID++
+	}
+}
+
+// syntheticEdgeField returns a field whose edges form walls every wallSpacing pixels with gaps in
+// them, and scattered noise with the given density.
+func syntheticEdgeField(size, wallSpacing int, density float64) *GradientField {
+	rng := rand.New(rand.NewSource(1))
+	field := NewGradientField(size, size)
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			wall := (i%wallSpacing == 0 || j%wallSpacing == 0) && (i+j)%(3*wallSpacing) > 20
+			field.IsLocalMax[i*size+j] = wall || rng.Float64() < density
+		}
+	}
+
+	return field
+}
+
+func TestSimpleNearestNeighborClustering(t *testing.T) {
+	if err := SimpleNearestNeighborClustering(NewGradientField(3, 3), 0); err == nil {
+		t.Error("expected zero neighbor range to fail")
+	}
+
+	t.Run("IDsInRowMajorOrder", func(t *testing.T) {
+		field := NewGradientField(6, 3)
+		for _, idx := range []int{4, 0, 7, 15, 17} {
+			field.IsLocalMax[idx] = true
+		}
+
+		if err := SimpleNearestNeighborClustering(field, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := map[int]int{0: 1, 4: 2, 7: 1, 15: 3, 17: 4}
+		for idx, id := range expected {
+			if field.ClusterID[idx] != id {
+				t.Errorf("expected edge %d to have cluster ID %d, got %d", idx, id, field.ClusterID[idx])
+			}
+		}
+	})
+
+	t.Run("MatchesRecursiveSearch", func(t *testing.T) {
+		for _, neighborRange := range []int{1, 2, 5} {
+			expected := syntheticEdgeField(120, 40, 0.02)
+			recursiveNeighborClustering(expected, neighborRange)
+
+			field := syntheticEdgeField(120, 40, 0.02)
+			if err := SimpleNearestNeighborClustering(field, neighborRange); err != nil {
+				t.Fatal(err)
+			}
+
+			for idx := range field.ClusterID {
+				if field.ClusterID[idx] != expected.ClusterID[idx] {
+					t.Fatalf("range %d: expected cluster ID %d at %d, got %d", neighborRange,
+						expected.ClusterID[idx], idx, field.ClusterID[idx])
+				}
+			}
+		}
+	})
+}
+
+// bridgedBlocksField returns two dense blocks of edges joined by a sparse bridge on row 4, at
+// columns 10, 14 and 17, and an isolated edge at (8, 28).
+func bridgedBlocksField() *GradientField {
+	field := NewGradientField(30, 10)
+	for i := 2; i < 6; i++ {
+		for j := 2; j < 8; j++ {
+			field.IsLocalMax[i*field.Width+j] = true
+			field.IsLocalMax[i*field.Width+j+18] = true
+		}
+	}
+
+	for _, j := range []int{10, 14, 17} {
+		field.IsLocalMax[4*field.Width+j] = true
+	}
+	field.IsLocalMax[8*field.Width+28] = true
+
+	return field
+}
+
+func TestDBSCANClustering(t *testing.T) {
+	if err := DBSCANClustering(NewGradientField(3, 3), 0.5, 3); err == nil {
+		t.Error("expected eps below one pixel to fail")
+	}
+
+	if err := DBSCANClustering(NewGradientField(3, 3), 2, 0); err == nil {
+		t.Error("expected zero minPoints to fail")
+	}
+
+	t.Run("NearestNeighborChainsBlocks", func(t *testing.T) {
+		field := bridgedBlocksField()
+		if err := SimpleNearestNeighborClustering(field, 4); err != nil {
+			t.Fatal(err)
+		}
+
+		if field.ClusterID[2*field.Width+2] != field.ClusterID[2*field.Width+20] {
+			t.Error("expected nearest neighbor clustering to join both blocks through the bridge")
+		}
+	})
+
+	t.Run("SeparatesBlocks", func(t *testing.T) {
+		field := bridgedBlocksField()
+		if err := DBSCANClustering(field, 3, 5); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := map[[2]int]int{
+			{2, 2}: 1, {5, 7}: 1, {4, 10}: 1,
+			{2, 20}: 2, {5, 25}: 2, {4, 17}: 2,
+			{4, 14}: NoiseClusterID, {8, 28}: NoiseClusterID,
+		}
+		for p, id := range expected {
+			if got := field.ClusterID[p[0]*field.Width+p[1]]; got != id {
+				t.Errorf("expected edge %v to have cluster ID %d, got %d", p, id, got)
+			}
+		}
+
+		clusters := GroupClusters(field)
+		if len(clusters) != 2 || len(clusters[1]) != 25 || len(clusters[2]) != 25 {
+			t.Errorf("expected two clusters of 25 edges without noise, got %d clusters", len(clusters))
+		}
+	})
+
+	t.Run("ReducesToNearestNeighborWithOnePoint", func(t *testing.T) {
+		expected := syntheticEdgeField(120, 40, 0.02)
+		if err := SimpleNearestNeighborClustering(expected, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		// A Euclidean radius of 1.5 covers the same 3x3 window.
+		field := syntheticEdgeField(120, 40, 0.02)
+		if err := DBSCANClustering(field, 1.5, 1); err != nil {
+			t.Fatal(err)
+		}
+
+		for idx := range field.ClusterID {
+			if field.ClusterID[idx] != expected.ClusterID[idx] {
+				t.Fatalf("expected cluster ID %d at %d, got %d", expected.ClusterID[idx], idx, field.ClusterID[idx])
+			}
+		}
+	})
+}
+
+func BenchmarkSimpleNearestNeighborClustering(b *testing.B) {
+	field := syntheticEdgeField(4000, 250, 0.001)
+
+	for _, neighborRange := range []int{2, 10} {
+		b.Run(fmt.Sprintf("RecursiveNeighborClustering with range %d on 4000x4000", neighborRange), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				recursiveNeighborClustering(field, neighborRange)
+			}
+		})
+
+		b.Run(fmt.Sprintf("SimpleNearestNeighborClustering with range %d on 4000x4000", neighborRange), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				SimpleNearestNeighborClustering(field, neighborRange)
+			}
+		})
+	}
+}
@@ -0,0 +1,345 @@
+package annotate
+
+import (
+	"math"
+	"sort"
+)
+
+// Hull modes
+const (
+	HullConvex    = "convex"
+	HullConcave   = "concave"
+	HullRectangle = "rectangle"
+)
+
+// ConcaveHullPolygons computes a concave keepout polygon for every cluster, see ConcaveHull.
+func ConcaveHullPolygons(clusters map[int][]*Point, concavity, lengthThreshold float64) map[int]*Polygon {
+	polygons := make(map[int]*Polygon, len(clusters))
+	for id, points := range clusters {
+		polygons[id] = &Polygon{
+			ClusterID: id,
+			NumPoints: len(points),
+			Vertices:  ConcaveHull(points, concavity, lengthThreshold),
+		}
+	}
+
+	return polygons
+}
+
+// ConcaveHull returns the vertices of a simple polygon that encloses a set of points and follows
+// their concavities. It starts from the convex hull and repeatedly digs an edge in toward the point
+// closest to it, as long as that point is within the edge length divided by concavity of one of
+// the edge ends. A concavity of 1 digs the deepest, a larger concavity keeps the polygon closer to
+// the convex hull. Edges shorter than lengthThreshold are not dug. An edge is only dug when the
+// triangle it cuts off holds no other point and the new edges do not cross the polygon, so every
+// point stays inside a simple polygon. Like MonotoneChainHull, collinear points are dropped and the
+// vertices are ordered counter-clockwise in (X, Y) coordinates.
+func ConcaveHull(points []*Point, concavity, lengthThreshold float64) []*Point {
+	hull := MonotoneChainHull(points)
+	if len(hull) < 3 {
+		return hull
+	}
+
+	unique := uniquePoints(points)
+	remaining := newPointBuckets(unique, 8)
+	for _, vertex := range hull {
+		remaining.remove(vertex)
+	}
+
+	// The hull is a circular doubly linked list, every vertex is the start of an edge to dig.
+	first := &hullNode{point: hull[0]}
+	queue := []*hullNode{first}
+	for _, vertex := range hull[1:] {
+		queue = append(queue, queue[len(queue)-1].insertAfter(vertex))
+	}
+	queue[len(queue)-1].next, first.prev = first, queue[len(queue)-1]
+
+	concavity = math.Max(concavity, 1)
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+
+		a, b := node.point, node.next.point
+		length := math.Sqrt(float64(squaredDistance(a, b)))
+		if length < lengthThreshold {
+			continue
+		}
+
+		point := digCandidate(first, node, remaining, length/concavity)
+		if point == nil {
+			continue
+		}
+
+		remaining.remove(point)
+		queue = append(queue, node, node.insertAfter(point))
+	}
+
+	vertices := []*Point{first.point}
+	for node := first.next; node != first; node = node.next {
+		vertices = append(vertices, node.point)
+	}
+
+	return dropCollinear(vertices)
+}
+
+// hullNode is a vertex of a polygon being dug.
+type hullNode struct {
+	point      *Point
+	prev, next *hullNode
+}
+
+func (n *hullNode) insertAfter(point *Point) *hullNode {
+	node := &hullNode{point: point, prev: n, next: n.next}
+	if n.next != nil {
+		n.next.prev = node
+	}
+	n.next = node
+
+	return node
+}
+
+// digCandidate returns the point that the edge starting at a node should be dug toward, or nil.
+// The point must be within maxDist of the edge and of one of its ends, closer to the edge than to
+// the neighboring edges unless it is in line with them, and the triangle it makes with the edge must not hold another point.
+func digCandidate(first, node *hullNode, remaining *pointBuckets, maxDist float64) *Point {
+	prev, a, b, next := node.prev.point, node.point, node.next.point, node.next.next.point
+
+	reach := int(math.Ceil(maxDist))
+	var candidates []*Point
+	dists := make(map[*Point]float64)
+	for _, point := range remaining.within(min(a.X, b.X)-reach, min(a.Y, b.Y)-reach, max(a.X, b.X)+reach,
+		max(a.Y, b.Y)+reach) {
+		if dist := segmentDistance(point, a, b); dist <= maxDist {
+			candidates = append(candidates, point)
+			dists[point] = dist
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if dists[candidates[i]] != dists[candidates[j]] {
+			return dists[candidates[i]] < dists[candidates[j]]
+		}
+
+		if candidates[i].Y != candidates[j].Y {
+			return candidates[i].Y < candidates[j].Y
+		}
+
+		return candidates[i].X < candidates[j].X
+	})
+
+	for _, point := range candidates {
+		dist := dists[point]
+
+		// A point on the edge splits it without digging.
+		if dist == 0 {
+			return point
+		}
+
+		if math.Sqrt(float64(min(squaredDistance(point, a), squaredDistance(point, b)))) > maxDist {
+			continue
+		}
+
+		if closerToEdge(point, prev, a, dist) || closerToEdge(point, b, next, dist) {
+			continue
+		}
+
+		// Every point inside the triangle is at most as far from the edge as its apex.
+		empty := true
+		for _, other := range candidates {
+			if dists[other] > dist {
+				break
+			}
+
+			if other != point && insideTriangle(a, point, b, other) {
+				empty = false
+				break
+			}
+		}
+
+		if empty && !crossesPolygon(first, node, point) {
+			return point
+		}
+	}
+
+	return nil
+}
+
+// closerToEdge indicates whether a point is closer to a neighboring edge than dist, so that it belongs
+// to that edge rather than to the one being dug. Points in line with the neighboring edge are left to
+// the other checks, since on a one-pixel wall every point would otherwise belong to the edge along it.
+func closerToEdge(point, u, v *Point, dist float64) bool {
+	return crossProduct(u, v, point) != 0 && dist >= segmentDistance(point, u, v)
+}
+
+// crossesPolygon indicates whether replacing the edge starting at a node by two edges through a
+// point would make the polygon touch itself.
+func crossesPolygon(first, node *hullNode, point *Point) bool {
+	a, b := node.point, node.next.point
+	for n := first; ; {
+		u, v := n.point, n.next.point
+		switch {
+		case n == node:
+		case n.next == node:
+			if overlapsFrom(a, u, point) || segmentsIntersect(u, v, point, b) {
+				return true
+			}
+		case n == node.next:
+			if overlapsFrom(b, v, point) || segmentsIntersect(u, v, a, point) {
+				return true
+			}
+		case segmentsIntersect(u, v, a, point) || segmentsIntersect(u, v, point, b):
+			return true
+		}
+
+		if n = n.next; n == first {
+			return false
+		}
+	}
+}
+
+// uniquePoints returns the points with distinct coordinates sorted by Y then X.
+func uniquePoints(points []*Point) []*Point {
+	sorted := make([]*Point, len(points))
+	copy(sorted, points)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Y != sorted[j].Y {
+			return sorted[i].Y < sorted[j].Y
+		}
+
+		return sorted[i].X < sorted[j].X
+	})
+
+	unique := sorted[:0:0]
+	for _, point := range sorted {
+		if len(unique) > 0 && unique[len(unique)-1].X == point.X && unique[len(unique)-1].Y == point.Y {
+			continue
+		}
+
+		unique = append(unique, point)
+	}
+
+	return unique
+}
+
+// segmentDistance returns the distance from a point to the closest point of a segment.
+func segmentDistance(point, a, b *Point) float64 {
+	dx, dy := float64(b.X-a.X), float64(b.Y-a.Y)
+	px, py := float64(point.X-a.X), float64(point.Y-a.Y)
+	if lengthSq := dx*dx + dy*dy; lengthSq > 0 {
+		t := math.Max(0, math.Min(1, (px*dx+py*dy)/lengthSq))
+		px, py = px-t*dx, py-t*dy
+	}
+
+	return math.Hypot(px, py)
+}
+
+// insideTriangle indicates whether a point lies inside or on the boundary of a triangle.
+func insideTriangle(a, b, c, point *Point) bool {
+	d1, d2, d3 := crossProduct(a, b, point), crossProduct(b, c, point), crossProduct(c, a, point)
+	hasNeg := d1 < 0 || d2 < 0 || d3 < 0
+	hasPos := d1 > 0 || d2 > 0 || d3 > 0
+	return !(hasNeg && hasPos)
+}
+
+// overlapsFrom indicates whether two segments that start from the same vertex overlap.
+func overlapsFrom(vertex, a, b *Point) bool {
+	ax, ay, bx, by := a.X-vertex.X, a.Y-vertex.Y, b.X-vertex.X, b.Y-vertex.Y
+	return ax*by-ay*bx == 0 && ax*bx+ay*by > 0
+}
+
+// segmentsIntersect indicates whether two closed segments have a point in common.
+func segmentsIntersect(a, b, c, d *Point) bool {
+	d1, d2 := crossProduct(c, d, a), crossProduct(c, d, b)
+	d3, d4 := crossProduct(a, b, c), crossProduct(a, b, d)
+	if ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) && ((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0)) {
+		return true
+	}
+
+	return (d1 == 0 && onSegment(c, d, a)) || (d2 == 0 && onSegment(c, d, b)) ||
+		(d3 == 0 && onSegment(a, b, c)) || (d4 == 0 && onSegment(a, b, d))
+}
+
+// onSegment indicates whether a point collinear with a segment lies within it.
+func onSegment(a, b, point *Point) bool {
+	return min(a.X, b.X) <= point.X && point.X <= max(a.X, b.X) &&
+		min(a.Y, b.Y) <= point.Y && point.Y <= max(a.Y, b.Y)
+}
+
+// dropCollinear removes the vertices of a closed polygon that lie between their neighbors.
+func dropCollinear(vertices []*Point) []*Point {
+	kept := make([]*Point, 0, len(vertices))
+	for i, vertex := range vertices {
+		prev, next := vertices[(i+len(vertices)-1)%len(vertices)], vertices[(i+1)%len(vertices)]
+		if crossProduct(prev, next, vertex) == 0 && onSegment(prev, next, vertex) {
+			continue
+		}
+
+		kept = append(kept, vertex)
+	}
+
+	return kept
+}
+
+func squaredDistance(a, b *Point) int {
+	return (a.X-b.X)*(a.X-b.X) + (a.Y-b.Y)*(a.Y-b.Y)
+}
+
+// pointBuckets is a uniform grid of square cells over a set of points for range queries.
+type pointBuckets struct {
+	cellSize   int
+	minX, minY int
+	cols, rows int
+	cells      [][]*Point
+}
+
+func newPointBuckets(points []*Point, cellSize int) *pointBuckets {
+	b := &pointBuckets{cellSize: cellSize, minX: points[0].X, minY: points[0].Y}
+	maxX, maxY := points[0].X, points[0].Y
+	for _, point := range points {
+		b.minX, b.minY = min(b.minX, point.X), min(b.minY, point.Y)
+		maxX, maxY = max(maxX, point.X), max(maxY, point.Y)
+	}
+
+	b.cols, b.rows = (maxX-b.minX)/cellSize+1, (maxY-b.minY)/cellSize+1
+	b.cells = make([][]*Point, b.cols*b.rows)
+	for _, point := range points {
+		idx := b.cell(point.X, point.Y)
+		b.cells[idx] = append(b.cells[idx], point)
+	}
+
+	return b
+}
+
+func (b *pointBuckets) cell(x, y int) int {
+	return ((y-b.minY)/b.cellSize)*b.cols + (x-b.minX)/b.cellSize
+}
+
+// remove removes the point with the same coordinates as a given point.
+func (b *pointBuckets) remove(point *Point) {
+	idx := b.cell(point.X, point.Y)
+	for i, p := range b.cells[idx] {
+		if p.X == point.X && p.Y == point.Y {
+			b.cells[idx] = append(b.cells[idx][:i], b.cells[idx][i+1:]...)
+			return
+		}
+	}
+}
+
+// within returns the points inside a rectangle, bounds are inclusive.
+func (b *pointBuckets) within(minX, minY, maxX, maxY int) []*Point {
+	minX, minY = max(minX, b.minX), max(minY, b.minY)
+	maxX, maxY = min(maxX, b.minX+b.cols*b.cellSize-1), min(maxY, b.minY+b.rows*b.cellSize-1)
+
+	var points []*Point
+	for i := (minY - b.minY) / b.cellSize; i <= (maxY-b.minY)/b.cellSize; i++ {
+		for j := (minX - b.minX) / b.cellSize; j <= (maxX-b.minX)/b.cellSize; j++ {
+			for _, point := range b.cells[i*b.cols+j] {
+				if minX <= point.X && point.X <= maxX && minY <= point.Y && point.Y <= maxY {
+					points = append(points, point)
+				}
+			}
+		}
+	}
+
+	return points
+}
@@ -0,0 +1,134 @@
+package annotate
+
+import (
+	"math"
+	"testing"
+)
+
+// lShape returns the outline of an L-shaped obstacle, 40 pixels tall and wide with 10 pixel thick
+// arms. The notch of the L spans X and Y from 10 to 40.
+func lShape() []*Point {
+	corners := [][2]int{{0, 0}, {0, 40}, {10, 40}, {10, 10}, {40, 10}, {40, 0}}
+
+	var points []*Point
+	for i, corner := range corners {
+		next := corners[(i+1)%len(corners)]
+		steps := max(abs(next[0]-corner[0]), abs(next[1]-corner[1]))
+		for k := 0; k < steps; k++ {
+			y := corner[0] + k*(next[0]-corner[0])/steps
+			x := corner[1] + k*(next[1]-corner[1])/steps
+			points = append(points, &Point{false, y, x})
+		}
+	}
+
+	return points
+}
+
+func abs(val int) int {
+	if val < 0 {
+		return -val
+	}
+
+	return val
+}
+
+func TestConcaveHull(t *testing.T) {
+	points := lShape()
+	convex := &Polygon{Vertices: MonotoneChainHull(points)}
+
+	t.Run("FollowsNotch", func(t *testing.T) {
+		hull := ConcaveHull(points, 1, 0)
+		polygon := &Polygon{Vertices: hull}
+		if signedArea(hull) <= 0 {
+			t.Errorf("expected counter-clockwise winding, got signed area %f", signedArea(hull))
+		}
+
+		// The L covers 40x10 + 30x10 square pixels between pixel centers.
+		if math.Abs(polygon.Area()-700) > 1e-9 {
+			t.Errorf("expected area 700 of the L, got %f with vertices %v", polygon.Area(), hull)
+		}
+
+		for _, point := range points {
+			if !insidePolygon(hull, point) {
+				t.Fatalf("expected %v to be inside the concave hull", point)
+			}
+		}
+
+		if insidePolygon(hull, &Point{false, 25, 25}) {
+			t.Error("expected the notch to be outside of the concave hull")
+		}
+	})
+
+	t.Run("ApproachesConvexHull", func(t *testing.T) {
+		polygon := &Polygon{Vertices: ConcaveHull(points, 100, 0)}
+		if polygon.Area() != convex.Area() {
+			t.Errorf("expected large concavity to keep the convex hull area %f, got %f", convex.Area(), polygon.Area())
+		}
+
+		polygon = &Polygon{Vertices: ConcaveHull(points, 1, 100)}
+		if polygon.Area() != convex.Area() {
+			t.Errorf("expected long length threshold to keep the convex hull area %f, got %f", convex.Area(),
+				polygon.Area())
+		}
+	})
+
+	t.Run("FollowsThinWalls", func(t *testing.T) {
+		// Two one-pixel walls that meet at a corner. Points along the walls are in line with the
+		// neighboring edges and must still be dug toward.
+		var walls []*Point
+		for _, end := range [][2]int{{11, 1}, {6, 12}} {
+			steps := max(abs(end[0]-20), abs(end[1]-20))
+			for k := 0; k <= steps; k++ {
+				y := 20 + int(math.Round(float64(k*(end[0]-20))/float64(steps)))
+				x := 20 + int(math.Round(float64(k*(end[1]-20))/float64(steps)))
+				walls = append(walls, &Point{false, y, x})
+			}
+		}
+
+		hull := ConcaveHull(walls, 2, 0)
+		polygon := &Polygon{Vertices: hull}
+		if !isSimplePolygon(hull) || signedArea(hull) <= 0 {
+			t.Fatalf("expected a counter-clockwise simple polygon, got %v", hull)
+		}
+
+		for _, point := range walls {
+			if !insidePolygon(hull, point) {
+				t.Fatalf("expected %v to be inside the concave hull", point)
+			}
+		}
+
+		if convexArea := (&Polygon{Vertices: MonotoneChainHull(walls)}).Area(); polygon.Area() > convexArea/4 {
+			t.Errorf("expected the hull to follow the walls, got area %f of %f for the convex hull",
+				polygon.Area(), convexArea)
+		}
+	})
+
+	t.Run("DegenerateClusters", func(t *testing.T) {
+		line := []*Point{{false, 0, 0}, {false, 1, 1}, {false, 2, 2}, {false, 1, 1}}
+		if hull := ConcaveHull(line, 1, 0); len(hull) != 2 {
+			t.Errorf("expected collinear points to yield 2 vertices, got %v", hull)
+		}
+	})
+}
+
+func TestPipelineConcaveHull(t *testing.T) {
+	opts := DefaultPipelineOptions()
+	opts.HullMode = HullConcave
+	res, err := NewPipeline(opts).Run(squareImage(100, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, polygon := range res.Polygons {
+		for _, point := range res.Clusters[id] {
+			if !insidePolygon(polygon.Vertices, point) {
+				t.Fatalf("expected %v to be inside the concave hull of cluster %d", point, id)
+			}
+		}
+	}
+
+	opts.HullConcavity = 0.5
+	if _, err := NewPipeline(opts).Run(squareImage(100, 30)); err == nil {
+		t.Error("expected concavity below 1 to fail")
+	}
+}
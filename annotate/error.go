@@ -1,5 +1,9 @@
 package annotate
 
+import "fmt"
+
+// MathError is returned when a matrix operation cannot be performed. The more specific errors below
+// unwrap to a MathError, so callers that only care about failure can match on MathError alone.
 type MathError struct {
 	Message string
 }
@@ -7,3 +11,118 @@ type MathError struct {
 func (m MathError) Error() string {
 	return m.Message
 }
+
+// KernelError is returned when a convolution kernel is not a square matrix of odd size.
+type KernelError struct {
+	MathError
+}
+
+func (k KernelError) Unwrap() error {
+	return k.MathError
+}
+
+// ImageError is returned when an image or a matrix has no pixel, when its rows do not have the same
+// length, or when a PGM image or a map_server YAML file is malformed.
+type ImageError struct {
+	MathError
+}
+
+func (e ImageError) Unwrap() error {
+	return e.MathError
+}
+
+// ParameterError is returned when a stage parameter is out of range.
+type ParameterError struct {
+	MathError
+	Name  string
+	Value interface{}
+}
+
+func (p ParameterError) Unwrap() error {
+	return p.MathError
+}
+
+func newKernelError(format string, args ...interface{}) KernelError {
+	return KernelError{MathError{fmt.Sprintf(format, args...)}}
+}
+
+func newImageError(format string, args ...interface{}) ImageError {
+	return ImageError{MathError{fmt.Sprintf(format, args...)}}
+}
+
+func newParameterError(name string, value interface{}, requirement string) ParameterError {
+	return ParameterError{
+		MathError: MathError{fmt.Sprintf("%s is %v but %s", name, value, requirement)},
+		Name:      name,
+		Value:     value,
+	}
+}
+
+// validateMat returns an error if a matrix is empty or ragged.
+func validateMat(mat [][]float64) error {
+	if len(mat) == 0 || len(mat[0]) == 0 {
+		return newImageError("matrix has no pixel")
+	}
+
+	for i := 1; i < len(mat); i++ {
+		if len(mat[i]) != len(mat[0]) {
+			return newImageError("row %d has %d columns instead of %d", i, len(mat[i]), len(mat[0]))
+		}
+	}
+
+	return nil
+}
+
+// validateGrid returns an error if a grid is empty or its values do not match its dimension.
+func validateGrid(grid *Grid) error {
+	if grid == nil || grid.Width <= 0 || grid.Height <= 0 {
+		return newImageError("grid has no pixel")
+	}
+
+	if len(grid.Values) != grid.Width*grid.Height {
+		return newImageError("grid has %d values instead of %d", len(grid.Values), grid.Width*grid.Height)
+	}
+
+	return nil
+}
+
+// validateGradientField returns an error if a gradient field is empty or its arrays do not match its
+// dimension.
+func validateGradientField(field *GradientField) error {
+	if field == nil || field.Width <= 0 || field.Height <= 0 {
+		return newImageError("gradient field has no pixel")
+	}
+
+	size := field.Width * field.Height
+	if len(field.X) != size || len(field.Y) != size || len(field.Dir) != size ||
+		len(field.IsLocalMax) != size || len(field.ClusterID) != size {
+		return newImageError("gradient field arrays do not have %d values", size)
+	}
+
+	return nil
+}
+
+// validateKernel returns an error if a kernel is not a square matrix of odd size.
+func validateKernel(kernel [][]float64) error {
+	if len(kernel)%2 != 1 {
+		return newKernelError("kernel size must be an odd integer, got %d", len(kernel))
+	}
+
+	for i := 0; i < len(kernel); i++ {
+		if len(kernel[i]) != len(kernel) {
+			return newKernelError("kernel must be square, row %d has %d columns instead of %d", i,
+				len(kernel[i]), len(kernel))
+		}
+	}
+
+	return nil
+}
+
+// validateNumRoutines returns an error if the number of go routines is not positive.
+func validateNumRoutines(numRoutines int) error {
+	if numRoutines < 1 {
+		return newParameterError("numRoutines", numRoutines, "must be at least 1")
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package annotate
+
+import (
+	"math"
+	"sort"
+)
+
+// ClusterFilter removes clusters that are unlikely to be keepouts, such as sensor speckle or the
+// outline of the whole building. A zero limit is not applied. Area is the area of the convex hull
+// of a cluster, extent is the longer side of its bounding box and aspect ratio is the longer side
+// over the shorter side. Limits are measured in pixels, or in metres in MapCoordinates.
+type ClusterFilter struct {
+	MinPixels      int     `json:"min_pixels"`
+	MaxPixels      int     `json:"max_pixels"`
+	MinArea        float64 `json:"min_area"`
+	MaxArea        float64 `json:"max_area"`
+	MinExtent      float64 `json:"min_extent"`
+	MaxExtent      float64 `json:"max_extent"`
+	MaxAspectRatio float64 `json:"max_aspect_ratio"`
+	// Coordinates is the unit of the limits, PixelCoordinates or MapCoordinates.
+	Coordinates string `json:"coordinates"`
+	// MergeDistance is the distance within which a cluster below a minimum joins the nearest cluster
+	// that passes the filter instead of being dropped. Zero drops every cluster below a minimum.
+	MergeDistance float64 `json:"merge_distance"`
+}
+
+// clusterShape holds the measures of a cluster that the filter looks at, in pixels.
+type clusterShape struct {
+	points                 []*Point
+	minY, minX, maxY, maxX int
+	area                   float64
+}
+
+func newClusterShape(points []*Point) *clusterShape {
+	shape := &clusterShape{
+		points: points,
+		minY:   points[0].Y,
+		minX:   points[0].X,
+		maxY:   points[0].Y,
+		maxX:   points[0].X,
+	}
+
+	for _, point := range points {
+		shape.minY, shape.maxY = min(shape.minY, point.Y), max(shape.maxY, point.Y)
+		shape.minX, shape.maxX = min(shape.minX, point.X), max(shape.maxX, point.X)
+	}
+
+	shape.area = (&Polygon{Vertices: MonotoneChainHull(points)}).Area()
+	return shape
+}
+
+// sides returns the longer and the shorter side of the bounding box in pixels.
+func (s *clusterShape) sides() (long, short float64) {
+	height, width := float64(s.maxY-s.minY+1), float64(s.maxX-s.minX+1)
+	return math.Max(height, width), math.Min(height, width)
+}
+
+// distance returns the shortest distance in pixels between the points of two clusters, or +Inf if
+// their bounding boxes are further apart than maxDist.
+func (s *clusterShape) distance(other *clusterShape, maxDist float64) float64 {
+	gapY := float64(max(0, max(other.minY-s.maxY, s.minY-other.maxY)))
+	gapX := float64(max(0, max(other.minX-s.maxX, s.minX-other.maxX)))
+	if math.Hypot(gapY, gapX) > maxDist {
+		return math.Inf(1)
+	}
+
+	dist := math.Inf(1)
+	for _, a := range s.points {
+		for _, b := range other.points {
+			dist = math.Min(dist, math.Hypot(float64(a.Y-b.Y), float64(a.X-b.X)))
+		}
+	}
+
+	return dist
+}
+
+// FilterClusters drops the clusters of a labeled gradient field that fall outside of the filter
+// limits by relabeling their edges as noise. Clusters below a minimum are merged into the nearest
+// cluster that passes the filter when one lies within MergeDistance, clusters above a maximum are
+// always dropped. The frame is only required for limits in MapCoordinates.
+func FilterClusters(field *GradientField, filter ClusterFilter, frame *MapFrame) error {
+	if err := validateGradientField(field); err != nil {
+		return err
+	}
+
+	scale, err := validateClusterFilter(filter, frame)
+	if err != nil {
+		return err
+	}
+
+	if filter == (ClusterFilter{Coordinates: filter.Coordinates}) {
+		return nil
+	}
+
+	clusters := GroupClusters(field)
+	ids := make([]int, 0, len(clusters))
+	for id := range clusters {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	shapes := make(map[int]*clusterShape, len(clusters))
+	var kept, small []int
+	for _, id := range ids {
+		shape := newClusterShape(clusters[id])
+		shapes[id] = shape
+
+		long, short := shape.sides()
+		long *= scale
+		area := shape.area * scale * scale
+		switch {
+		case exceeds(float64(len(shape.points)), float64(filter.MaxPixels)) || exceeds(area, filter.MaxArea) ||
+			exceeds(long, filter.MaxExtent) || exceeds(long/short, filter.MaxAspectRatio):
+			relabel(field, shape.points, NoiseClusterID)
+		case len(shape.points) < filter.MinPixels || area < filter.MinArea || long < filter.MinExtent:
+			small = append(small, id)
+		default:
+			kept = append(kept, id)
+		}
+	}
+
+	// Small clusters only merge into clusters that passed the filter, so merges do not chain.
+	maxDist := filter.MergeDistance / scale
+	for _, id := range small {
+		target, targetDist := NoiseClusterID, math.Inf(1)
+		if filter.MergeDistance > 0 {
+			for _, keptID := range kept {
+				if dist := shapes[id].distance(shapes[keptID], maxDist); dist <= maxDist && dist < targetDist {
+					target, targetDist = keptID, dist
+				}
+			}
+		}
+
+		relabel(field, shapes[id].points, target)
+	}
+
+	return nil
+}
+
+// validateClusterFilter returns an error if a filter limit is out of range, and otherwise the size
+// of a pixel in the unit of the limits.
+func validateClusterFilter(filter ClusterFilter, frame *MapFrame) (float64, error) {
+	limits := []struct {
+		name, maxName string
+		min, max      float64
+	}{
+		{"MinPixels", "MaxPixels", float64(filter.MinPixels), float64(filter.MaxPixels)},
+		{"MinArea", "MaxArea", filter.MinArea, filter.MaxArea},
+		{"MinExtent", "MaxExtent", filter.MinExtent, filter.MaxExtent},
+	}
+
+	for _, limit := range limits {
+		if limit.min < 0 {
+			return 0, newParameterError(limit.name, limit.min, "must not be negative")
+		}
+
+		if limit.max < 0 || (limit.max > 0 && limit.max < limit.min) {
+			return 0, newParameterError(limit.maxName, limit.max, "must be zero or at least "+limit.name)
+		}
+	}
+
+	if filter.MergeDistance < 0 {
+		return 0, newParameterError("MergeDistance", filter.MergeDistance, "must not be negative")
+	}
+
+	if filter.MaxAspectRatio != 0 && filter.MaxAspectRatio < 1 {
+		return 0, newParameterError("MaxAspectRatio", filter.MaxAspectRatio, "must be at least 1")
+	}
+
+	switch filter.Coordinates {
+	case "", PixelCoordinates:
+		return 1, nil
+	case MapCoordinates:
+		if frame == nil {
+			return 0, newParameterError("Coordinates", filter.Coordinates, "requires a map with a known resolution")
+		}
+
+		return frame.Resolution, nil
+	default:
+		return 0, newParameterError("Coordinates", filter.Coordinates, "must be pixel or map")
+	}
+}
+
+// exceeds indicates whether a value is above a limit, a zero limit is never exceeded.
+func exceeds(val, limit float64) bool {
+	return limit > 0 && val > limit
+}
+
+func relabel(field *GradientField, points []*Point, clusterID int) {
+	for _, point := range points {
+		field.ClusterID[point.Y*field.Width+point.X] = clusterID
+	}
+}
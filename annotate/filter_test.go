@@ -0,0 +1,98 @@
+package annotate
+
+import (
+	"errors"
+	"testing"
+)
+
+// filterField returns a labeled field with a 5x5 block as cluster 1, a single edge 3 pixels away
+// from the block as cluster 2, an isolated edge as cluster 3 and a horizontal line as cluster 4.
+func filterField(t *testing.T) *GradientField {
+	field := NewGradientField(30, 20)
+	for i := 2; i < 7; i++ {
+		for j := 2; j < 7; j++ {
+			field.IsLocalMax[i*field.Width+j] = true
+		}
+	}
+
+	field.IsLocalMax[4*field.Width+9] = true
+	field.IsLocalMax[10*field.Width+20] = true
+	for j := 0; j < field.Width; j++ {
+		field.IsLocalMax[18*field.Width+j] = true
+	}
+
+	if err := SimpleNearestNeighborClustering(field, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	return field
+}
+
+func TestFilterClusters(t *testing.T) {
+	testCases := []struct {
+		name     string
+		filter   ClusterFilter
+		frame    *MapFrame
+		expected map[[2]int]int
+	}{
+		{
+			name:     "NoLimit",
+			filter:   ClusterFilter{},
+			expected: map[[2]int]int{{2, 2}: 1, {4, 9}: 2, {10, 20}: 3, {18, 0}: 4},
+		},
+		{
+			name:     "DropBelowMinPixels",
+			filter:   ClusterFilter{MinPixels: 2},
+			expected: map[[2]int]int{{2, 2}: 1, {4, 9}: NoiseClusterID, {10, 20}: NoiseClusterID, {18, 0}: 4},
+		},
+		{
+			name:     "MergeBelowMinPixels",
+			filter:   ClusterFilter{MinPixels: 2, MergeDistance: 5},
+			expected: map[[2]int]int{{2, 2}: 1, {4, 9}: 1, {10, 20}: NoiseClusterID, {18, 0}: 4},
+		},
+		{
+			name:     "DropAboveMaxAspectRatio",
+			filter:   ClusterFilter{MaxAspectRatio: 5},
+			expected: map[[2]int]int{{2, 2}: 1, {4, 9}: 2, {10, 20}: 3, {18, 0}: NoiseClusterID},
+		},
+		{
+			name:     "DropBelowMinArea",
+			filter:   ClusterFilter{MinArea: 1},
+			expected: map[[2]int]int{{2, 2}: 1, {4, 9}: NoiseClusterID, {10, 20}: NoiseClusterID, {18, 0}: NoiseClusterID},
+		},
+		{
+			name:     "DropAboveMaxExtentInMetres",
+			filter:   ClusterFilter{MaxExtent: 2, Coordinates: MapCoordinates},
+			frame:    &MapFrame{Resolution: 0.5, Height: 20},
+			expected: map[[2]int]int{{2, 2}: NoiseClusterID, {4, 9}: 2, {10, 20}: 3, {18, 0}: NoiseClusterID},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			field := filterField(t)
+			if err := FilterClusters(field, tc.filter, tc.frame); err != nil {
+				t.Fatal(err)
+			}
+
+			for p, id := range tc.expected {
+				if got := field.ClusterID[p[0]*field.Width+p[1]]; got != id {
+					t.Errorf("expected edge %v to have cluster ID %d, got %d", p, id, got)
+				}
+			}
+		})
+	}
+
+	t.Run("InvalidFilter", func(t *testing.T) {
+		var paramErr ParameterError
+		err := FilterClusters(filterField(t), ClusterFilter{MinPixels: 10, MaxPixels: 5}, nil)
+		if !errors.As(err, &paramErr) || paramErr.Name != "MaxPixels" {
+			t.Errorf("expected MaxPixels parameter error, got %v", err)
+		}
+
+		err = FilterClusters(filterField(t), ClusterFilter{MinArea: 1, Coordinates: MapCoordinates}, nil)
+		if !errors.As(err, &paramErr) || paramErr.Name != "Coordinates" {
+			t.Errorf("expected Coordinates parameter error without map frame, got %v", err)
+		}
+	})
+}
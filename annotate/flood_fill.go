@@ -14,45 +14,305 @@ func (c *Coordinate) IsInBound(maxRow, maxCol int) bool {
 // filled with white.
 const FloodFillVal = 255.0
 
+// Seed modes of flood fill
+const (
+	// SeedTopLeftCorner starts flood fill from pixel (0, 0).
+	SeedTopLeftCorner = "top-left"
+	// SeedBorder starts flood fill from every border pixel that matches the exterior value.
+	SeedBorder = "border"
+	// SeedCoordinates starts flood fill from a list of coordinates.
+	SeedCoordinates = "coordinates"
+)
+
+// Match modes of flood fill
+const (
+	// MatchRelative matches intensities within a fraction of the seed intensity.
+	MatchRelative = "relative"
+	// MatchAbsolute matches intensities within a difference from the seed intensity.
+	MatchAbsolute = "absolute"
+	// MatchRange matches intensities within a fixed range regardless of the seed.
+	MatchRange = "range"
+)
+
+// FloodFillPredicate indicates whether a pixel intensity belongs to the region that flood fill
+// grows from a seed of the given intensity.
+type FloodFillPredicate func(seedVal, val float64) bool
+
+// RelativeTolerance matches intensities within seedVal*(1±tolerance). The range collapses to a
+// single value for a black seed, AbsoluteTolerance or ValueRange suit dark exteriors better.
+func RelativeTolerance(tolerance float64) FloodFillPredicate {
+	return func(seedVal, val float64) bool {
+		return seedVal*(1.0-tolerance) <= val && val <= seedVal*(1.0+tolerance)
+	}
+}
+
+// AbsoluteTolerance matches intensities within seedVal±tolerance.
+func AbsoluteTolerance(tolerance float64) FloodFillPredicate {
+	return func(seedVal, val float64) bool {
+		return seedVal-tolerance <= val && val <= seedVal+tolerance
+	}
+}
+
+// ValueRange matches intensities between low and high inclusively whatever the seed intensity.
+func ValueRange(low, high float64) FloodFillPredicate {
+	return func(_, val float64) bool {
+		return low <= val && val <= high
+	}
+}
+
+// MatchValue turns a test on pixel intensity into a predicate that ignores the seed intensity.
+func MatchValue(match func(val float64) bool) FloodFillPredicate {
+	return func(_, val float64) bool {
+		return match(val)
+	}
+}
+
 // FloodFillFromTopLeftCorner uses breadth first approach to flood fill an image to get rid of
 // exterior wall.
-func FloodFillFromTopLeftCorner(mat [][]float64, neighborDist int, tolerance float64) [][]float64 {
-	// Instantiate a mask that is an identical copy of the original mat
-	mask := make([][]float64, len(mat))
-	visitRecord := make([][]bool, len(mat))
-	for i := 0; i < len(mat); i++ {
-		visitRecord[i] = make([]bool, len(mat[i]))
-		mask[i] = make([]float64, len(mat[i]))
-		copy(mask[i], mat[i])
-	}
-
-	srcVal := mat[0][0]
-	queue := []*Coordinate{&Coordinate{0, 0}}
+func FloodFillFromTopLeftCorner(grid *Grid, neighborDist int, tolerance float64) (*Grid, error) {
+	if tolerance < 0 {
+		return nil, newParameterError("tolerance", tolerance, "must not be negative")
+	}
+
+	return FloodFillFromSeeds(grid, []*Coordinate{{0, 0}}, neighborDist, RelativeTolerance(tolerance))
+}
+
+// FloodFillFromSeeds flood fills an image from several seeds at once, for exterior space that is
+// split into several regions. Every seed fills the pixels that match its own intensity, and a pixel
+// goes to the first seed region that reaches it.
+func FloodFillFromSeeds(grid *Grid, seeds []*Coordinate, neighborDist int, match FloodFillPredicate) (*Grid,
+	error) {
+	if err := validateFloodFill(grid, neighborDist, match); err != nil {
+		return nil, err
+	}
+
+	if len(seeds) == 0 {
+		return nil, newParameterError("seeds", seeds, "must not be empty")
+	}
+
+	srcVals := make([]float64, len(seeds))
+	for k, seed := range seeds {
+		if !seed.IsInBound(grid.Height, grid.Width) {
+			return nil, newParameterError("seeds", *seed, "must be inside the image")
+		}
+
+		srcVals[k] = grid.At(seed.I, seed.J)
+	}
+
+	return floodFill(grid, seeds, srcVals, neighborDist, match), nil
+}
+
+// FloodFillFromBorder flood fills an image from every border pixel that matches the exterior
+// intensity, so exterior space is removed wherever the map was cropped. Pixels are matched against
+// the exterior intensity rather than the intensity of the border pixel. An image without such a
+// border pixel is returned unchanged.
+func FloodFillFromBorder(grid *Grid, exteriorVal float64, neighborDist int, match FloodFillPredicate) (*Grid,
+	error) {
+	if err := validateFloodFill(grid, neighborDist, match); err != nil {
+		return nil, err
+	}
+
+	seeds := BorderSeeds(grid, exteriorVal, match)
+	srcVals := make([]float64, len(seeds))
+	for k := range srcVals {
+		srcVals[k] = exteriorVal
+	}
+
+	return floodFill(grid, seeds, srcVals, neighborDist, match), nil
+}
+
+// BorderSeeds returns the border pixels of an image that match the exterior intensity, going
+// clockwise from the top-left corner.
+func BorderSeeds(grid *Grid, exteriorVal float64, match FloodFillPredicate) []*Coordinate {
+	var border []*Coordinate
+	for j := 0; j < grid.Width; j++ {
+		border = append(border, &Coordinate{0, j})
+	}
+	for i := 1; i < grid.Height; i++ {
+		border = append(border, &Coordinate{i, grid.Width - 1})
+	}
+	for j := grid.Width - 2; j >= 0 && grid.Height > 1; j-- {
+		border = append(border, &Coordinate{grid.Height - 1, j})
+	}
+	for i := grid.Height - 2; i > 0 && grid.Width > 1; i-- {
+		border = append(border, &Coordinate{i, 0})
+	}
+
+	var seeds []*Coordinate
+	for _, c := range border {
+		if match(exteriorVal, grid.At(c.I, c.J)) {
+			seeds = append(seeds, c)
+		}
+	}
+
+	return seeds
+}
+
+func validateFloodFill(grid *Grid, neighborDist int, match FloodFillPredicate) error {
+	if err := validateGrid(grid); err != nil {
+		return err
+	}
+
+	if neighborDist < 1 {
+		return newParameterError("neighborDist", neighborDist, "must be at least 1")
+	}
+
+	if match == nil {
+		return newParameterError("match", "nil", "must be a predicate")
+	}
+
+	return nil
+}
+
+// floodFill runs a breadth first flood fill from every seed, a pixel is filled when it neighbors a
+// pixel that matches the seed intensity.
+func floodFill(grid *Grid, seeds []*Coordinate, srcVals []float64, neighborDist int, match FloodFillPredicate) *Grid {
+	type item struct {
+		c      *Coordinate
+		srcVal float64
+	}
+
+	// Instantiate a mask that is an identical copy of the original grid
+	mask := grid.Clone()
+	visitRecord := make([]bool, grid.Width*grid.Height)
+
+	queue := make([]item, 0, len(seeds))
+	for k, seed := range seeds {
+		queue = append(queue, item{seed, srcVals[k]})
+	}
+
 	for len(queue) > 0 {
-		c := queue[0]
+		c, srcVal := queue[0].c, queue[0].srcVal
 		queue = queue[1:]
-		if srcVal*(1.0-tolerance) <= mat[c.I][c.J] && mat[c.I][c.J] <= srcVal*(1.0+tolerance) {
+		if match(srcVal, grid.At(c.I, c.J)) {
 			for i := c.I - neighborDist; i <= c.I+neighborDist; i++ {
 				for j := c.J - neighborDist; j <= c.J+neighborDist; j++ {
-					if i < 0 || i >= len(mat) {
+					if !grid.InBound(i, j) {
 						continue
 					}
 
-					if j < 0 || j >= len(mat[i]) {
+					idx := i*grid.Width + j
+					if visitRecord[idx] {
 						continue
 					}
 
-					if visitRecord[i][j] {
+					mask.Values[idx] = FloodFillVal
+					visitRecord[idx] = true
+					queue = append(queue, item{&Coordinate{i, j}, srcVal})
+				}
+			}
+		}
+	}
+
+	return mask
+}
+
+// ScanlineFloodFill flood fills an image from seeds like FloodFillFromSeeds with bounded memory. It
+// fills runs of matching pixels along rows and only stacks the start of the runs it finds above and
+// below, then dilates the matching region by neighborDist in a separate pass. The output is the same
+// as FloodFillFromSeeds for a neighborDist of 1. Larger distances only dilate the region and do not
+// let it jump over non-matching pixels, and seeds fill their regions one after the other.
+func ScanlineFloodFill(grid *Grid, seeds []*Coordinate, neighborDist int, match FloodFillPredicate) (*Grid, error) {
+	if err := validateFloodFill(grid, neighborDist, match); err != nil {
+		return nil, err
+	}
+
+	if len(seeds) == 0 {
+		return nil, newParameterError("seeds", seeds, "must not be empty")
+	}
+
+	srcVals := make([]float64, len(seeds))
+	for k, seed := range seeds {
+		if !seed.IsInBound(grid.Height, grid.Width) {
+			return nil, newParameterError("seeds", *seed, "must be inside the image")
+		}
+
+		srcVals[k] = grid.At(seed.I, seed.J)
+	}
+
+	return scanlineFill(grid, seeds, srcVals, neighborDist, match), nil
+}
+
+// ScanlineFloodFillFromBorder flood fills an image from every border pixel that matches the
+// exterior intensity like FloodFillFromBorder, with the scanline fill of ScanlineFloodFill.
+func ScanlineFloodFillFromBorder(grid *Grid, exteriorVal float64, neighborDist int, match FloodFillPredicate) (*Grid,
+	error) {
+	if err := validateFloodFill(grid, neighborDist, match); err != nil {
+		return nil, err
+	}
+
+	seeds := BorderSeeds(grid, exteriorVal, match)
+	srcVals := make([]float64, len(seeds))
+	for k := range srcVals {
+		srcVals[k] = exteriorVal
+	}
+
+	return scanlineFill(grid, seeds, srcVals, neighborDist, match), nil
+}
+
+// scanlineFill marks the 8-connected region of matching pixels around every seed, then fills the
+// region dilated by neighborDist.
+func scanlineFill(grid *Grid, seeds []*Coordinate, srcVals []float64, neighborDist int, match FloodFillPredicate) *Grid {
+	width := grid.Width
+	region := NewMask(width, grid.Height)
+	matches := func(idx int, srcVal float64) bool {
+		return !region.Values[idx] && match(srcVal, grid.Values[idx])
+	}
+
+	// The stack holds pixel indices, one per run of matching pixels still to be filled.
+	var stack []int
+	for k, seed := range seeds {
+		srcVal := srcVals[k]
+		stack = append(stack[:0], seed.I*width+seed.J)
+		for len(stack) > 0 {
+			idx := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if !matches(idx, srcVal) {
+				continue
+			}
+
+			i, j := idx/width, idx%width
+			left, right := j, j
+			for left > 0 && matches(i*width+left-1, srcVal) {
+				left--
+			}
+			for right < width-1 && matches(i*width+right+1, srcVal) {
+				right++
+			}
+
+			for x := left; x <= right; x++ {
+				region.Values[i*width+x] = true
+			}
+
+			// Diagonal neighbors count, so the rows above and below are scanned one pixel wider.
+			for _, y := range []int{i - 1, i + 1} {
+				if y < 0 || y >= grid.Height {
+					continue
+				}
+
+				inRun := false
+				for x := max(left-1, 0); x <= min(right+1, width-1); x++ {
+					if !matches(y*width+x, srcVal) {
+						inRun = false
 						continue
 					}
 
-					mask[i][j] = FloodFillVal
-					visitRecord[i][j] = true
-					queue = append(queue, &Coordinate{i, j})
+					if !inRun {
+						stack = append(stack, y*width+x)
+						inRun = true
+					}
 				}
 			}
 		}
 	}
 
+	element, _ := NewStructuringElement(ElementSquare, neighborDist)
+	mask := grid.Clone()
+	for idx, filled := range dilateMask(region, element).Values {
+		if filled {
+			mask.Values[idx] = FloodFillVal
+		}
+	}
+
 	return mask
 }
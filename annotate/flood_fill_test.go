@@ -1,13 +1,262 @@
 package annotate
 
-import "testing"
+import (
+	"math/rand"
+	"testing"
+)
 
 func BenchmarkFloodFill(b *testing.B) {
-	m := randomMat(1000, 1000)
+	m := randomGrid(1000, 1000)
 
 	b.Run("FloodFillFromTopLeftCorner", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
 			FloodFillFromTopLeftCorner(m, 5, 0.10)
 		}
 	})
+
+	b.Run("ScanlineFloodFill", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			ScanlineFloodFill(m, []*Coordinate{{0, 0}}, 5, RelativeTolerance(0.10))
+		}
+	})
+
+	// A uniform image is filled entirely, which is the worst case for the breadth first queue.
+	uniform := onesGrid(1000, 1000)
+
+	b.Run("FloodFillFromTopLeftCornerUniform", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			FloodFillFromTopLeftCorner(uniform, 5, 0.10)
+		}
+	})
+
+	b.Run("ScanlineFloodFillUniform", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ScanlineFloodFill(uniform, []*Coordinate{{0, 0}}, 5, RelativeTolerance(0.10))
+		}
+	})
+}
+
+func TestFloodFillFromTopLeftCorner(t *testing.T) {
+	if _, err := FloodFillFromTopLeftCorner(&Grid{}, 1, 0.1); err == nil {
+		t.Error("expected empty matrix to fail")
+	}
+
+	if _, err := FloodFillFromTopLeftCorner(onesGrid(3, 3), 0, 0.1); err == nil {
+		t.Error("expected zero neighbor distance to fail")
+	}
+
+	mask, err := FloodFillFromTopLeftCorner(onesGrid(3, 3), 1, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, val := range mask.Values {
+		if val != FloodFillVal {
+			t.Errorf("expected uniform matrix to be filled at (%d, %d), got %f", idx/mask.Width, idx%mask.Width, val)
+		}
+	}
+}
+
+func TestFloodFillFromSeeds(t *testing.T) {
+	// A black wall in column 3 splits the image into two gray regions.
+	grid, err := NewGridFromMat([][]float64{
+		{100, 100, 100, 0, 100, 100, 100},
+		{100, 100, 100, 0, 100, 100, 100},
+		{100, 100, 100, 0, 100, 100, 100},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mask, err := FloodFillFromSeeds(grid, []*Coordinate{{0, 0}}, 1, RelativeTolerance(0.1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mask.At(1, 3) != FloodFillVal || mask.At(1, 4) != 100 {
+		t.Errorf("expected a single seed to stop at the wall, got %v", mask.Mat())
+	}
+
+	mask, err = FloodFillFromSeeds(grid, []*Coordinate{{0, 0}, {2, 6}}, 1, RelativeTolerance(0.1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, val := range mask.Values {
+		if val != FloodFillVal {
+			t.Errorf("expected both regions to be filled at (%d, %d), got %f", idx/mask.Width, idx%mask.Width, val)
+		}
+	}
+
+	if _, err := FloodFillFromSeeds(grid, nil, 1, RelativeTolerance(0.1)); err == nil {
+		t.Error("expected missing seeds to fail")
+	}
+
+	if _, err := FloodFillFromSeeds(grid, []*Coordinate{{3, 0}}, 1, RelativeTolerance(0.1)); err == nil {
+		t.Error("expected seed outside of the image to fail")
+	}
+}
+
+func TestFloodFillFromBorder(t *testing.T) {
+	// The map is cropped so that its top-left corner is free space rather than unknown exterior.
+	grid, err := NewGridFromMat([][]float64{
+		{254, 205, 205, 205, 205, 205},
+		{205, 0, 0, 0, 0, 205},
+		{205, 0, 254, 254, 0, 205},
+		{205, 0, 254, 254, 0, 205},
+		{205, 0, 0, 0, 0, 205},
+		{205, 205, 205, 205, 205, 205},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if seeds := BorderSeeds(grid, UnknownVal, RelativeTolerance(0.1)); len(seeds) != 19 {
+		t.Errorf("expected 19 border seeds, got %d", len(seeds))
+	}
+
+	mask, err := FloodFillFromBorder(grid, UnknownVal, 1, RelativeTolerance(0.1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < grid.Height; i++ {
+		for j := 0; j < grid.Width; j++ {
+			interior := i >= 2 && i <= 3 && j >= 2 && j <= 3
+			if interior && mask.At(i, j) != 254 {
+				t.Errorf("expected interior pixel (%d, %d) to be kept, got %f", i, j, mask.At(i, j))
+			}
+
+			if !interior && mask.At(i, j) != FloodFillVal {
+				t.Errorf("expected exterior and wall pixel (%d, %d) to be filled, got %f", i, j, mask.At(i, j))
+			}
+		}
+	}
+
+	if seeds := BorderSeeds(onesGrid(1, 4), 1, RelativeTolerance(0)); len(seeds) != 4 {
+		t.Errorf("expected every pixel of a single row to be a border seed once, got %d", len(seeds))
+	}
+}
+
+func TestFloodFillPredicates(t *testing.T) {
+	// A black exterior crossed by a column of sensor noise, fenced off from the interior by a wall.
+	grid, err := NewGridFromMat([][]float64{
+		{0, 0, 3, 0, 0, 100, 100, 128},
+		{0, 0, 2, 0, 0, 100, 100, 128},
+		{0, 0, 4, 0, 0, 100, 100, 128},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	predicates := []struct {
+		name   string
+		match  FloodFillPredicate
+		filled int
+	}{
+		{"RelativeTolerance", RelativeTolerance(0.1), 9},
+		{"AbsoluteTolerance", AbsoluteTolerance(5), 18},
+		{"ValueRange", ValueRange(0, 10), 18},
+		{"MatchValue", MatchValue(func(val float64) bool { return val < 10 }), 18},
+	}
+
+	for _, pred := range predicates {
+		t.Run(pred.name, func(t *testing.T) {
+			mask, err := FloodFillFromSeeds(grid, []*Coordinate{{0, 0}}, 1, pred.match)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			filled := 0
+			for _, val := range mask.Values {
+				if val == FloodFillVal {
+					filled++
+				}
+			}
+
+			// A black seed only matches exact black with a relative tolerance, so the noise stops it.
+			if filled != pred.filled {
+				t.Errorf("expected %d filled pixels, got %d in %v", pred.filled, filled, mask.Mat())
+			}
+
+			if mask.At(1, 6) != 100 || mask.At(1, 7) != 128 {
+				t.Errorf("expected the interior to be kept, got %v", mask.Mat())
+			}
+		})
+	}
+
+	if _, err := FloodFillFromSeeds(grid, []*Coordinate{{0, 0}}, 1, nil); err == nil {
+		t.Error("expected nil predicate to fail")
+	}
+}
+
+func TestScanlineFloodFill(t *testing.T) {
+	// Few intensity levels give large irregular regions with diagonal links and holes.
+	rng := rand.New(rand.NewSource(1))
+	grid := NewGrid(60, 40)
+	for idx := range grid.Values {
+		grid.Values[idx] = float64(rng.Intn(3))
+	}
+	grid.Values[0] = 0
+
+	expected, err := FloodFillFromTopLeftCorner(grid, 1, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mask, err := ScanlineFloodFill(grid, []*Coordinate{{0, 0}}, 1, RelativeTolerance(0.1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx := range mask.Values {
+		if mask.Values[idx] != expected.Values[idx] {
+			t.Fatalf("expected scanline fill to match breadth first fill at (%d, %d), got %f instead of %f",
+				idx/mask.Width, idx%mask.Width, mask.Values[idx], expected.Values[idx])
+		}
+	}
+
+	expected, err = FloodFillFromBorder(grid, 1, 1, AbsoluteTolerance(0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mask, err = ScanlineFloodFillFromBorder(grid, 1, 1, AbsoluteTolerance(0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx := range mask.Values {
+		if mask.Values[idx] != expected.Values[idx] {
+			t.Fatalf("expected scanline fill from the border to match breadth first fill at (%d, %d)",
+				idx/mask.Width, idx%mask.Width)
+		}
+	}
+
+	// A single matching pixel is dilated into a square of the neighbor distance.
+	grid = onesGrid(9, 9)
+	grid.Values[4*9+4] = 0
+	mask, err = ScanlineFloodFill(grid, []*Coordinate{{4, 4}}, 3, RelativeTolerance(0.1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < grid.Height; i++ {
+		for j := 0; j < grid.Width; j++ {
+			inside := i >= 1 && i <= 7 && j >= 1 && j <= 7
+			if filled := mask.At(i, j) == FloodFillVal; filled != inside {
+				t.Errorf("expected pixel (%d, %d) filled to be %v, got %f", i, j, inside, mask.At(i, j))
+			}
+		}
+	}
+
+	if _, err := ScanlineFloodFill(grid, []*Coordinate{{9, 0}}, 1, RelativeTolerance(0.1)); err == nil {
+		t.Error("expected seed outside of the image to fail")
+	}
+
+	if _, err := ScanlineFloodFill(grid, []*Coordinate{{0, 0}}, 0, RelativeTolerance(0.1)); err == nil {
+		t.Error("expected zero neighbor distance to fail")
+	}
 }
@@ -1,5 +1,7 @@
 package annotate
 
+import "math"
+
 // Kernel attributes, kernel size should always be odd and offset is the always kernel size minus
 // one divide by two.
 const (
@@ -31,78 +33,90 @@ func init() {
 	}
 }
 
-// GaussianMask applies Gaussian blur to an image matrix.
-func GaussianMask(mat [][]float64) [][]float64 {
-	maskedGrid := make([][]float64, len(mat))
-	for i := 0; i < len(mat); i++ {
-		maskedGrid[i] = make([]float64, len(mat[i]))
-		for j := 0; j < len(mat[i]); j++ {
-			maskedGrid[i][j] = gaussFilter(mat, i, j)
-		}
+// NewGaussianKernel builds a normalized Gaussian kernel of any odd size. A larger sigma blurs more
+// aggressively, the size should be around six times sigma to capture most of the distribution.
+func NewGaussianKernel(size int, sigma float64) ([][]float64, error) {
+	if size < 1 || size%2 != 1 {
+		return nil, newKernelError("kernel size must be a positive odd integer, got %d", size)
 	}
 
-	return maskedGrid
-}
-
-// ParallelGaussianMask applies Gaussian blur to an image matrix using multiple subroutines to
-// achieve parallelism.
-func ParallelGaussianMask(mat [][]float64, numRoutines int) [][]float64 {
-	rowsPerRoutine := len(mat) / numRoutines
-	outputChan := make(chan *submask, numRoutines)
-
-	n := 0
-	for n < numRoutines-1 {
-		go getGaussSubmask(mat, n, n*rowsPerRoutine, (n+1)*rowsPerRoutine, outputChan)
-		n++
+	if sigma <= 0 {
+		return nil, newParameterError("sigma", sigma, "must be positive")
 	}
 
-	go getGaussSubmask(mat, n, n*rowsPerRoutine, len(mat), outputChan)
-
-	n = 0
-	submasks := make([]*submask, numRoutines)
-	for submask := range outputChan {
-		submasks[submask.Order] = submask
-		n++
+	offset := (size - 1) / 2
+	kernel := make([][]float64, size)
 
-		if n == numRoutines {
-			break
+	var norm float64
+	for i := 0; i < size; i++ {
+		kernel[i] = make([]float64, size)
+		for j := 0; j < size; j++ {
+			y, x := float64(i-offset), float64(j-offset)
+			kernel[i][j] = math.Exp(-(x*x + y*y) / (2 * sigma * sigma))
+			norm += kernel[i][j]
 		}
 	}
 
-	mask := [][]float64{}
-	for _, submask := range submasks {
-		mask = append(mask, submask.Values...)
+	for i := 0; i < size; i++ {
+		for j := 0; j < size; j++ {
+			kernel[i][j] /= norm
+		}
 	}
 
-	return mask
+	return kernel, nil
 }
 
-type submask struct {
-	Order    int
-	StartRow int
-	Values   [][]float64
+// GaussianMask applies Gaussian blur to an image grid. The border mode determines how the kernel
+// treats pixels outside of the image, an empty mode means BorderZero.
+func GaussianMask(grid *Grid, border BorderMode) (*Grid, error) {
+	return ParallelGaussianMaskWithKernel(grid, GaussKernel, 1, border)
 }
 
-// getGaussSubmask is called in the optimized version of gaussian masking. It is called in
-// multiple go routines to achieve parallel convolution operations.
-func getGaussSubmask(mat [][]float64, n, startRow, endRow int, output chan *submask) {
-	rowSize := endRow - startRow
-	values := make([][]float64, rowSize)
-	for i := 0; i < rowSize; i++ {
-		colSize := len(mat[startRow+i])
-		values[i] = make([]float64, colSize)
-		for j := 0; j < colSize; j++ {
-			values[i][j] = gaussFilter(mat, startRow+i, j)
-		}
+// GaussianMaskWithKernel applies Gaussian blur to an image grid using the given kernel, see
+// NewGaussianKernel.
+func GaussianMaskWithKernel(grid *Grid, kernel [][]float64, border BorderMode) (*Grid, error) {
+	return ParallelGaussianMaskWithKernel(grid, kernel, 1, border)
+}
+
+// ParallelGaussianMask applies Gaussian blur to an image grid using multiple subroutines to
+// achieve parallelism.
+func ParallelGaussianMask(grid *Grid, numRoutines int, border BorderMode) (*Grid, error) {
+	return ParallelGaussianMaskWithKernel(grid, GaussKernel, numRoutines, border)
+}
+
+// ParallelGaussianMaskWithKernel applies Gaussian blur to an image grid using the given kernel and
+// multiple subroutines to achieve parallelism. Every subroutine convolves its own band of rows.
+func ParallelGaussianMaskWithKernel(grid *Grid, kernel [][]float64, numRoutines int,
+	border BorderMode) (*Grid, error) {
+	if err := validateGrid(grid); err != nil {
+		return nil, err
+	}
+
+	mode, err := resolveBorder(border)
+	if err != nil {
+		return nil, err
 	}
 
-	output <- &submask{
-		Order:    n,
-		StartRow: startRow,
-		Values:   values,
+	if err := validateKernel(kernel); err != nil {
+		return nil, err
 	}
+
+	if err := validateNumRoutines(numRoutines); err != nil {
+		return nil, err
+	}
+
+	mask := NewGrid(grid.Width, grid.Height)
+	parallelRows(grid.Height, numRoutines, func(startRow, endRow int) {
+		for i := startRow; i < endRow; i++ {
+			for j := 0; j < grid.Width; j++ {
+				mask.Values[i*grid.Width+j] = convolve(grid, i, j, kernel, mode)
+			}
+		}
+	})
+
+	return mask, nil
 }
 
-func gaussFilter(mat [][]float64, y, x int) float64 {
-	return convolve(mat, y, x, 5, GaussKernel)
+func gaussFilter(grid *Grid, y, x int) float64 {
+	return convolve(grid, y, x, GaussKernel, BorderZero)
 }
@@ -0,0 +1,111 @@
+package annotate
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// Coordinate systems of exported keepout polygons.
+const (
+	// PixelCoordinates uses [X, Y] image pixel coordinates.
+	PixelCoordinates = "pixel"
+	// MapCoordinates uses [X, Y] map frame coordinates in metres, it requires a map frame.
+	MapCoordinates = "map"
+)
+
+// FeatureCollection is a GeoJSON feature collection as defined by RFC 7946.
+type FeatureCollection struct {
+	Type     string     `json:"type"`
+	Features []*Feature `json:"features"`
+}
+
+// Feature is a GeoJSON feature.
+type Feature struct {
+	Type       string                 `json:"type"`
+	Geometry   *Geometry              `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// Geometry is a GeoJSON geometry. Coordinates hold a position, a list of positions or a list of
+// linear rings depending on the geometry type.
+type Geometry struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+// KeepoutFeatureCollection exports the keepout polygons of a pipeline result as GeoJSON features
+// ordered by cluster ID. Every polygon ring is closed and counter-clockwise in the chosen coordinate
+// system. Clusters that are too small to enclose an area are exported as a Point or a LineString.
+// Every feature lists the clusters it was built from, which are several for merged polygons.
+func KeepoutFeatureCollection(res *PipelineResult, mapName, coordinates string) (*FeatureCollection, error) {
+	if coordinates != PixelCoordinates && coordinates != MapCoordinates {
+		return nil, newParameterError("coordinates", coordinates, "must be pixel or map")
+	}
+
+	if coordinates == MapCoordinates && res.Frame == nil {
+		return nil, newParameterError("coordinates", coordinates, "requires a pipeline result with a map frame")
+	}
+
+	ids := make([]int, 0, len(res.Polygons))
+	for id := range res.Polygons {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	fc := &FeatureCollection{Type: "FeatureCollection", Features: []*Feature{}}
+	for _, id := range ids {
+		polygon := res.Polygons[id]
+
+		var positions [][]float64
+		area, perimeter := polygon.Area(), polygon.Perimeter()
+		if coordinates == MapCoordinates {
+			for _, vertex := range res.Frame.PolygonToWorld(polygon) {
+				positions = append(positions, []float64{vertex.X, vertex.Y})
+			}
+			area, perimeter = res.Frame.Area(polygon), res.Frame.Perimeter(polygon)
+		} else {
+			for _, vertex := range polygon.Vertices {
+				positions = append(positions, []float64{float64(vertex.X), float64(vertex.Y)})
+			}
+		}
+
+		fc.Features = append(fc.Features, &Feature{
+			Type:     "Feature",
+			Geometry: newGeometry(positions),
+			Properties: map[string]interface{}{
+				"cluster_id":         polygon.ClusterID,
+				"source_cluster_ids": polygon.sourceClusterIDs(),
+				"pixel_count":        polygon.NumPoints,
+				"area":               area,
+				"perimeter":          perimeter,
+				"map":                mapName,
+				"coordinates":        coordinates,
+				"parameters":         res.Options,
+			},
+		})
+	}
+
+	return fc, nil
+}
+
+// Encode writes the feature collection as indented JSON.
+func (fc *FeatureCollection) Encode(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(fc)
+}
+
+func newGeometry(positions [][]float64) *Geometry {
+	switch len(positions) {
+	case 0:
+		return nil
+	case 1:
+		return &Geometry{Type: "Point", Coordinates: positions[0]}
+	case 2:
+		return &Geometry{Type: "LineString", Coordinates: positions}
+	}
+
+	ring := append(positions, positions[0])
+	return &Geometry{Type: "Polygon", Coordinates: [][][]float64{ring}}
+}
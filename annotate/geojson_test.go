@@ -0,0 +1,99 @@
+package annotate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestKeepoutFeatureCollection(t *testing.T) {
+	square := []*Point{{Y: 0, X: 0}, {Y: 0, X: 2}, {Y: 2, X: 2}, {Y: 2, X: 0}, {Y: 1, X: 1}}
+	res := &PipelineResult{
+		Options: DefaultPipelineOptions(),
+		Frame:   &MapFrame{Resolution: 0.5, Height: 3},
+		Polygons: map[int]*Polygon{
+			2: {ClusterID: 2, NumPoints: 1, Vertices: []*Point{{Y: 5, X: 5}}},
+			1: {ClusterID: 1, NumPoints: len(square), Vertices: MonotoneChainHull(square)},
+		},
+	}
+
+	t.Run("PixelCoordinates", func(t *testing.T) {
+		fc, err := KeepoutFeatureCollection(res, "office", PixelCoordinates)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(fc.Features) != 2 || fc.Features[0].Properties["cluster_id"] != 1 {
+			t.Fatalf("expected features ordered by cluster ID, got %v", fc.Features)
+		}
+
+		polygon := fc.Features[0]
+		ring := polygon.Geometry.Coordinates.([][][]float64)[0]
+		if polygon.Geometry.Type != "Polygon" || len(ring) != 5 {
+			t.Fatalf("expected closed ring with 5 positions, got %v", ring)
+		}
+
+		if ring[0][0] != ring[4][0] || ring[0][1] != ring[4][1] {
+			t.Errorf("expected ring to be closed, got %v", ring)
+		}
+
+		if polygon.Properties["area"] != 4.0 || polygon.Properties["pixel_count"] != 5 {
+			t.Errorf("unexpected properties %v", polygon.Properties)
+		}
+
+		if fc.Features[1].Geometry.Type != "Point" {
+			t.Errorf("expected single pixel cluster to be a Point, got %s", fc.Features[1].Geometry.Type)
+		}
+	})
+
+	t.Run("MapCoordinates", func(t *testing.T) {
+		fc, err := KeepoutFeatureCollection(res, "office", MapCoordinates)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fc.Features[0].Properties["area"] != 1.0 {
+			t.Errorf("expected area of 1 square metre, got %v", fc.Features[0].Properties["area"])
+		}
+
+		buf := &bytes.Buffer{}
+		if err := fc.Encode(buf); err != nil {
+			t.Fatal(err)
+		}
+
+		decoded := struct {
+			Type     string
+			Features []struct {
+				Properties struct {
+					Map        string
+					Parameters PipelineOptions
+				}
+			}
+		}{}
+		if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		if decoded.Type != "FeatureCollection" || decoded.Features[0].Properties.Map != "office" {
+			t.Errorf("unexpected encoded feature collection %s", buf.String())
+		}
+
+		if !reflect.DeepEqual(decoded.Features[0].Properties.Parameters, DefaultPipelineOptions()) {
+			t.Errorf("expected pipeline parameters to round trip, got %+v", decoded.Features[0].Properties.Parameters)
+		}
+	})
+
+	t.Run("MissingFrame", func(t *testing.T) {
+		var paramErr ParameterError
+		if _, err := KeepoutFeatureCollection(&PipelineResult{}, "office", MapCoordinates); !errors.As(err,
+			&paramErr) || paramErr.Name != "coordinates" {
+			t.Errorf("expected coordinates parameter error without a frame, got %v", err)
+		}
+
+		if _, err := KeepoutFeatureCollection(&PipelineResult{}, "office", "utm"); !errors.As(err, &paramErr) {
+			t.Errorf("expected coordinates parameter error, got %v", err)
+		}
+	})
+}
@@ -30,137 +30,107 @@ var Gy = [][]float64{
 	{-1.0, -2.0, -1.0},
 }
 
-// GradientMask takes an image matrix and returns a matrix of gradients.
-func GradientMask(mat [][]float64) [][]*Gradient {
-	mask := make([][]*Gradient, len(mat))
-	for i := 0; i < len(mat); i++ {
-		mask[i] = make([]*Gradient, len(mat[i]))
-		for j := 0; j < len(mat[i]); j++ {
-			mask[i][j] = computeGradient(mat, i, j)
-		}
-	}
+// Direction codes, they index Directions.
+const (
+	codeNone uint8 = iota
+	codeE
+	codeNE
+	codeN
+	codeNW
+	codeW
+	codeSW
+	codeS
+	codeSE
+)
 
-	return mask
+// GradientMask takes an image grid and returns a field of gradients. The border mode determines how
+// the Sobel operators treat pixels outside of the image, an empty mode means BorderZero.
+func GradientMask(grid *Grid, border BorderMode) (*GradientField, error) {
+	return ParallelGradientMask(grid, 1, border)
 }
 
-// NonMaximumSuppression looks at each gradient in the matrix and identifies local maxima. The
+// NonMaximumSuppression looks at each gradient in the field and identifies local maxima. The
 // reason why it is called non-maximum suppression is that it normally sets the gradients to zero if
 // they are not local maxima.
-func NonMaximumSuppression(mask [][]*Gradient, threshold float64) {
-	for i := 0; i < len(mask); i++ {
-		for j := 0; j < len(mask[i]); j++ {
-			var forward, backward *Coordinate
-			switch mask[i][j].Dir {
-			case E:
-				forward = &Coordinate{i, j + 1}
-				backward = &Coordinate{i, j - 1}
-			case NE:
-				forward = &Coordinate{i - 1, j + 1}
-				backward = &Coordinate{i + 1, j - 1}
-			case N:
-				forward = &Coordinate{i - 1, j}
-				backward = &Coordinate{i + 1, j}
-			case NW:
-				forward = &Coordinate{i - 1, j - 1}
-				backward = &Coordinate{i + 1, j + 1}
-			case W:
-				forward = &Coordinate{i, j - 1}
-				backward = &Coordinate{i, j + 1}
-			case SW:
-				forward = &Coordinate{i + 1, j - 1}
-				backward = &Coordinate{i - 1, j + 1}
-			case S:
-				forward = &Coordinate{i + 1, j}
-				backward = &Coordinate{i - 1, j}
-			case SE:
-				forward = &Coordinate{i + 1, j + 1}
-				backward = &Coordinate{i - 1, j - 1}
-			default:
-				forward = &Coordinate{i, j}
-				backward = &Coordinate{i, j}
-			}
+func NonMaximumSuppression(field *GradientField, threshold float64) error {
+	if err := validateGradientField(field); err != nil {
+		return err
+	}
 
-			numRow, numCol := len(mask), len(mask[i])
-			if forward.IsInBound(numRow, numCol) && backward.IsInBound(numRow, numCol) {
-				mask[i][j].IsLocalMax = mask[forward.I][forward.J].Magnitude() < mask[i][j].Magnitude() &&
-					mask[backward.I][backward.J].Magnitude() < mask[i][j].Magnitude() &&
-					mask[i][j].Magnitude() > threshold
+	for i := 0; i < field.Height; i++ {
+		for j := 0; j < field.Width; j++ {
+			idx := i*field.Width + j
+			offset := directionOffsets[field.Dir[idx]]
+			forwardI, forwardJ := i+offset[0], j+offset[1]
+			backwardI, backwardJ := i-offset[0], j-offset[1]
+
+			if field.InBound(forwardI, forwardJ) && field.InBound(backwardI, backwardJ) {
+				mag := field.magnitude(idx)
+				field.IsLocalMax[idx] = field.magnitude(forwardI*field.Width+forwardJ) < mag &&
+					field.magnitude(backwardI*field.Width+backwardJ) < mag &&
+					mag > threshold
 			}
 		}
 	}
-}
 
-// ParallelGradientMask converts a 2D matrix of image intensity to a 2D matrix of image gradient.
-func ParallelGradientMask(mat [][]float64, numRoutines int) [][]*Gradient {
-	rowsPerRoutine := len(mat) / numRoutines
-	outputChan := make(chan *gradientSubmask, numRoutines)
+	return nil
+}
 
-	n := 0
-	for n < numRoutines-1 {
-		go getGradientSubmask(mat, n, n*rowsPerRoutine, (n+1)*rowsPerRoutine, outputChan)
-		n++
+// ParallelGradientMask converts a grid of image intensity to a field of image gradient using
+// multiple go routines.
+func ParallelGradientMask(grid *Grid, numRoutines int, border BorderMode) (*GradientField, error) {
+	if err := validateSobel(grid); err != nil {
+		return nil, err
 	}
-	go getGradientSubmask(mat, n, n*rowsPerRoutine, len(mat), outputChan)
-
-	n = 0
-	partialMasks := make([]*gradientSubmask, numRoutines)
-	for partialMask := range outputChan {
-		partialMasks[partialMask.Order] = partialMask
-		n++
-		if n == numRoutines {
-			break
-		}
+
+	if err := validateNumRoutines(numRoutines); err != nil {
+		return nil, err
 	}
 
-	mask := [][]*Gradient{}
-	for _, partialMask := range partialMasks {
-		mask = append(mask, partialMask.Values...)
+	mode, err := resolveBorder(border)
+	if err != nil {
+		return nil, err
 	}
 
-	return mask
-}
+	field := NewGradientField(grid.Width, grid.Height)
+	parallelRows(grid.Height, numRoutines, func(startRow, endRow int) {
+		for i := startRow; i < endRow; i++ {
+			for j := 0; j < grid.Width; j++ {
+				computeGradient(grid, field, i, j, mode)
+			}
+		}
+	})
 
-// gradientSubmask is part of a larger gradient mask that is applied to the whole image.
-// TODO: Combine this with Submask using empty interface for values.
-type gradientSubmask struct {
-	Order    int
-	StartRow int
-	Values   [][]*Gradient
+	return field, nil
 }
 
-func getGradientSubmask(mat [][]float64, n, startRow, endRow int, output chan *gradientSubmask) {
-	rowSize := endRow - startRow
-	values := make([][]*Gradient, rowSize)
-	for i := 0; i < rowSize; i++ {
-		colSize := len(mat[startRow+i])
-		values[i] = make([]*Gradient, colSize)
-		for j := 0; j < colSize; j++ {
-			values[i][j] = computeGradient(mat, startRow+i, j)
-		}
+// validateSobel returns an error if the image grid or the Sobel operators cannot be convolved.
+func validateSobel(grid *Grid) error {
+	if err := validateGrid(grid); err != nil {
+		return err
 	}
 
-	output <- &gradientSubmask{
-		Order:    n,
-		StartRow: startRow,
-		Values:   values,
+	if err := validateKernel(Gx); err != nil {
+		return err
 	}
-}
 
-// ComputeGradient uses Sobel operators to derive gradient value for a given pixel.
-func computeGradient(mat [][]float64, y, x int) *Gradient {
-	grad := &Gradient{
-		X: convolve(mat, y, x, 3, Gx),
-		Y: convolve(mat, y, x, 3, Gy),
+	if len(Gy) != len(Gx) {
+		return newKernelError("Sobel operators must have the same size")
 	}
 
-	// SetDirection determines direction of a gradient.
-	grad.SetDirection()
-	return grad
+	return validateKernel(Gy)
 }
 
-// Convolve performs convolution on a given location of a matrix. The operation assumes zero padding
-// i.e. the contribution from out of bound region is zero.
-func convolve(mat [][]float64, y, x, kernelSize int, kernel [][]float64) (sum float64) {
+// ComputeGradient uses Sobel operators to derive gradient value for a given pixel and stores it in
+// the field.
+func computeGradient(grid *Grid, field *GradientField, y, x int, mode BorderMode) {
+	field.setVector(y*grid.Width+x, convolve(grid, y, x, Gx, mode), convolve(grid, y, x, Gy, mode))
+}
+
+// Convolve performs convolution on a given location of a grid. The border mode determines the
+// contribution from out of bound region, with BorderZero it is zero.
+func convolve(grid *Grid, y, x int, kernel [][]float64, mode BorderMode) (sum float64) {
+	kernelSize := len(kernel)
 	if kernelSize%2 != 1 {
 		panic("kernel size must be an odd integer")
 	}
@@ -168,16 +138,23 @@ func convolve(mat [][]float64, y, x, kernelSize int, kernel [][]float64) (sum fl
 	offset := (kernelSize - 1) / 2
 
 	for i := 0; i < kernelSize; i++ {
-		if y+i-offset < 0 || len(mat) <= y+i-offset {
-			continue
+		row, ok := y+i-offset, true
+		if row < 0 || grid.Height <= row {
+			if row, ok = borderIndex(row, grid.Height, mode); !ok {
+				continue
+			}
 		}
 
+		rowValues := grid.Values[row*grid.Width : (row+1)*grid.Width]
 		for j := 0; j < kernelSize; j++ {
-			if x+j-offset < 0 || len(mat[i]) <= x+j-offset {
-				continue
+			col, ok := x+j-offset, true
+			if col < 0 || grid.Width <= col {
+				if col, ok = borderIndex(col, grid.Width, mode); !ok {
+					continue
+				}
 			}
 
-			sum += kernel[i][j] * mat[y+i-offset][x+j-offset]
+			sum += kernel[i][j] * rowValues[col]
 		}
 	}
 
@@ -201,63 +178,70 @@ func (g *Gradient) Magnitude() float64 {
 
 // SetDirection determines direction of a gradient.
 func (g *Gradient) SetDirection() {
-	if g.X == 0.0 {
-		if g.Y > 0.0 {
-			g.Dir = N
-		} else if g.Y < 0.0 {
-			g.Dir = S
+	g.Dir = Directions[directionCode(g.X, g.Y)]
+}
+
+// directionCode quantizes the direction of a gradient vector into an index of Directions.
+func directionCode(x, y float64) uint8 {
+	if x == 0.0 {
+		if y > 0.0 {
+			return codeN
+		} else if y < 0.0 {
+			return codeS
 		}
 
-		return
+		return codeNone
 	}
 
-	angle := math.Atan2(g.Y, g.X)
+	angle := math.Atan2(y, x)
 
 	var quadrant int
-	if g.X > 0.0 && g.Y >= 0.0 {
+	if x > 0.0 && y >= 0.0 {
 		quadrant = 1
-	} else if g.X < 0.0 && g.Y >= 0.0 {
+	} else if x < 0.0 && y >= 0.0 {
 		quadrant = 2
-	} else if g.X < 0.0 && g.Y < 0.0 {
+	} else if x < 0.0 && y < 0.0 {
 		quadrant = 3
-	} else if g.X > 0.0 && g.Y < 0.0 {
+	} else if x > 0.0 && y < 0.0 {
 		quadrant = 4
 	}
 
 	switch quadrant {
 	case 1:
 		if 0 <= angle && angle < math.Pi/8 {
-			g.Dir = E
+			return codeE
 		} else if math.Pi/8 <= angle && angle < 3*math.Pi/8 {
-			g.Dir = NE
+			return codeNE
 		} else {
-			g.Dir = N
+			return codeN
 		}
 	case 2:
 		if math.Pi/2 <= angle && angle < 5*math.Pi/8 {
-			g.Dir = N
+			return codeN
 		} else if 5*math.Pi/8 < angle && angle < 7*math.Pi/8 {
-			g.Dir = NW
+			return codeNW
 		} else {
-			g.Dir = W
+			return codeW
 		}
 	case 3:
 		angle += 2 * math.Pi
 		if math.Pi <= angle && angle < 9*math.Pi/8 {
-			g.Dir = W
+			return codeW
 		} else if 9*math.Pi/8 <= angle && angle < 11*math.Pi/8 {
-			g.Dir = SW
+			return codeSW
 		} else {
-			g.Dir = S
+			return codeS
 		}
 	case 4:
 		angle += 2 * math.Pi
 		if 1.5*math.Pi <= angle && angle < 13*math.Pi/8 {
-			g.Dir = S
+			return codeS
 		} else if 13*math.Pi/8 <= angle && angle < 15*math.Pi/8 {
-			g.Dir = SE
+			return codeSE
 		} else {
-			g.Dir = E
+			return codeE
 		}
 	}
+
+	return codeNone
 }
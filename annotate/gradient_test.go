@@ -1,51 +1,137 @@
 package annotate
 
 import (
+	"fmt"
+	"math"
 	"testing"
 )
 
 func BenchmarkGaussianMask(b *testing.B) {
-	m := randomMat(1000, 1000)
+	m := randomGrid(1000, 1000)
 
 	b.Run("RegularGaussianMask", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			GaussianMask(m)
+			GaussianMask(m, BorderZero)
 		}
 	})
 
 	b.Run("ParallelGaussianMask with 1 go-routine", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			ParallelGaussianMask(m, 1)
+			ParallelGaussianMask(m, 1, BorderZero)
 		}
 	})
 
 	b.Run("ParallelGaussianMask with 2 go-routines", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			ParallelGaussianMask(m, 2)
+			ParallelGaussianMask(m, 2, BorderZero)
 		}
 	})
 
 	b.Run("ParallelGaussianMask with 4 go-routines", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			ParallelGaussianMask(m, 4)
+			ParallelGaussianMask(m, 4, BorderZero)
 		}
 	})
 
 	b.Run("ParallelGaussianMask with 32 go-routines", func(b *testing.B) {
 		for i := 0; i < b.N; i++ {
-			ParallelGaussianMask(m, 32)
+			ParallelGaussianMask(m, 32, BorderZero)
+		}
+	})
+}
+
+func BenchmarkSeparableGaussianMask(b *testing.B) {
+	m := randomGrid(1000, 1000)
+
+	for _, size := range []int{5, 11} {
+		kernel, _ := NewGaussianKernel(size, float64(size)/6)
+		kernel1D, _ := NewGaussianKernel1D(size, float64(size)/6)
+
+		b.Run(fmt.Sprintf("GaussianMaskWithKernel %dx%d", size, size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				GaussianMaskWithKernel(m, kernel, BorderZero)
+			}
+		})
+
+		b.Run(fmt.Sprintf("ParallelGaussianMaskWithKernel %dx%d with 4 go-routines", size, size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ParallelGaussianMaskWithKernel(m, kernel, 4, BorderZero)
+			}
+		})
+
+		b.Run(fmt.Sprintf("SeparableGaussianMask %dx%d", size, size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				SeparableGaussianMask(m, kernel1D, BorderZero)
+			}
+		})
+
+		b.Run(fmt.Sprintf("ParallelSeparableGaussianMask %dx%d with 4 go-routines", size, size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ParallelSeparableGaussianMask(m, kernel1D, 4, BorderZero)
+			}
+		})
+	}
+}
+
+func BenchmarkSeparableGradientMask(b *testing.B) {
+	m := randomGrid(1000, 1000)
+
+	b.Run("GradientMask", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			GradientMask(m, BorderZero)
+		}
+	})
+
+	b.Run("SeparableGradientMask", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			SeparableGradientMask(m, BorderZero)
+		}
+	})
+}
+
+func TestSeparableConvolution(t *testing.T) {
+	mat := randomGrid(30, 40)
+
+	t.Run("Gaussian", func(t *testing.T) {
+		kernel, _ := NewGaussianKernel(7, 1.5)
+		kernel1D, _ := NewGaussianKernel1D(7, 1.5)
+		expected, _ := GaussianMaskWithKernel(mat, kernel, BorderZero)
+		result, err := ParallelSeparableGaussianMask(mat, kernel1D, 4, BorderZero)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for idx := range expected.Values {
+			if math.Abs(expected.Values[idx]-result.Values[idx]) > 1e-12 {
+				t.Fatalf("separable blur differs at %d: %f != %f", idx, result.Values[idx], expected.Values[idx])
+			}
+		}
+	})
+
+	t.Run("Sobel", func(t *testing.T) {
+		expected, _ := GradientMask(mat, BorderZero)
+		result, err := ParallelSeparableGradientMask(mat, 3, BorderZero)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for idx := range expected.X {
+			if math.Abs(expected.X[idx]-result.X[idx]) > 1e-12 || math.Abs(expected.Y[idx]-result.Y[idx]) > 1e-12 {
+				t.Fatalf("separable gradient differs at %d: (%f, %f) != (%f, %f)", idx, result.X[idx], result.Y[idx],
+					expected.X[idx], expected.Y[idx])
+			}
 		}
 	})
 }
 
 func TestGaussFilter(t *testing.T) {
-	img := [][]float64{
+	img, _ := NewGridFromMat([][]float64{
 		{0, 0, 0, 0, 0},
 		{0, 1, 1, 1, 0},
 		{0, 1, 1, 1, 0},
 		{0, 1, 1, 1, 0},
 		{0, 0, 0, 0, 0},
-	}
+	})
 
 	t.Run("ApplyToCenter", func(t *testing.T) {
 		result := gaussFilter(img, 2, 2)
@@ -53,7 +139,7 @@ func TestGaussFilter(t *testing.T) {
 		var expected float64
 		for i := 0; i < KernelSize; i++ {
 			for j := 0; j < KernelSize; j++ {
-				expected += GaussKernel[i][j] * img[i][j]
+				expected += GaussKernel[i][j] * img.At(i, j)
 			}
 		}
 
@@ -68,7 +154,7 @@ func TestGaussFilter(t *testing.T) {
 		var expected float64
 		for i := 2; i < KernelSize; i++ {
 			for j := 2; j < KernelSize; j++ {
-				expected += GaussKernel[i][j] * img[i-2][j-2]
+				expected += GaussKernel[i][j] * img.At(i-2, j-2)
 			}
 		}
 
@@ -77,3 +163,46 @@ func TestGaussFilter(t *testing.T) {
 		}
 	})
 }
+
+func TestNewGaussianKernel(t *testing.T) {
+	kernel, err := NewGaussianKernel(7, 1.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sum float64
+	for i := 0; i < len(kernel); i++ {
+		for j := 0; j < len(kernel[i]); j++ {
+			sum += kernel[i][j]
+			if kernel[i][j] != kernel[j][i] || kernel[i][j] != kernel[6-i][6-j] {
+				t.Errorf("expected kernel to be symmetric at (%d, %d)", i, j)
+			}
+		}
+	}
+
+	if math.Abs(sum-1) > 1e-12 {
+		t.Errorf("expected kernel to be normalized, got sum %f", sum)
+	}
+
+	if kernel[3][3] <= kernel[3][2] {
+		t.Error("expected kernel to peak at its center")
+	}
+
+	if _, err := NewGaussianKernel(4, 1); err == nil {
+		t.Error("expected even kernel size to fail")
+	}
+
+	mat := randomGrid(20, 20)
+	regular, _ := GaussianMaskWithKernel(mat, kernel, BorderZero)
+	parallel, _ := ParallelGaussianMaskWithKernel(mat, kernel, 3, BorderZero)
+	for idx := range regular.Values {
+		if regular.Values[idx] != parallel.Values[idx] {
+			t.Fatalf("expected parallel mask to match regular mask at %d", idx)
+		}
+	}
+
+	blurred, _ := GaussianMaskWithKernel(onesGrid(20, 20), kernel, BorderZero)
+	if math.Abs(blurred.At(10, 10)-1) > 1e-12 {
+		t.Errorf("expected uniform image to stay uniform away from the border, got %f", blurred.At(10, 10))
+	}
+}
@@ -0,0 +1,165 @@
+package annotate
+
+import (
+	"math"
+	"sync"
+)
+
+// Grid is a matrix of pixel values stored contiguously in row-major order. Compared to a slice of
+// rows, it takes a single allocation and keeps neighboring rows close in memory.
+type Grid struct {
+	Width  int
+	Height int
+	Values []float64
+}
+
+// NewGrid returns a grid of zeros.
+func NewGrid(width, height int) *Grid {
+	return &Grid{
+		Width:  width,
+		Height: height,
+		Values: make([]float64, width*height),
+	}
+}
+
+// NewGridFromMat copies a matrix indexed by [row][col] into a grid.
+func NewGridFromMat(mat [][]float64) (*Grid, error) {
+	if err := validateMat(mat); err != nil {
+		return nil, err
+	}
+
+	grid := NewGrid(len(mat[0]), len(mat))
+	for i := 0; i < len(mat); i++ {
+		copy(grid.Values[i*grid.Width:(i+1)*grid.Width], mat[i])
+	}
+
+	return grid, nil
+}
+
+// At returns the value at row y and column x.
+func (g *Grid) At(y, x int) float64 {
+	return g.Values[y*g.Width+x]
+}
+
+// Set assigns the value at row y and column x.
+func (g *Grid) Set(y, x int, val float64) {
+	g.Values[y*g.Width+x] = val
+}
+
+// InBound indicates whether row y and column x lie inside the grid.
+func (g *Grid) InBound(y, x int) bool {
+	return 0 <= y && y < g.Height && 0 <= x && x < g.Width
+}
+
+// Clone returns a deep copy of the grid.
+func (g *Grid) Clone() *Grid {
+	clone := NewGrid(g.Width, g.Height)
+	copy(clone.Values, g.Values)
+	return clone
+}
+
+// Mat copies the grid into a matrix indexed by [row][col].
+func (g *Grid) Mat() [][]float64 {
+	mat := make([][]float64, g.Height)
+	for i := 0; i < g.Height; i++ {
+		mat[i] = make([]float64, g.Width)
+		copy(mat[i], g.Values[i*g.Width:(i+1)*g.Width])
+	}
+
+	return mat
+}
+
+// Directions maps the direction codes stored in a GradientField to gradient directions. Code zero
+// is a gradient without direction.
+var Directions = []string{"", E, NE, N, NW, W, SW, S, SE}
+
+// directionOffsets are the [row, col] steps toward the direction of every direction code.
+var directionOffsets = [][2]int{{0, 0}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}, {1, 0}, {1, 1}}
+
+// GradientField is a struct of arrays holding the gradient of every pixel of an image in row-major
+// order. It avoids one heap object per pixel that a matrix of *Gradient requires.
+type GradientField struct {
+	Width  int
+	Height int
+	X      []float64
+	Y      []float64
+	// Dir holds direction codes, see Directions.
+	Dir        []uint8
+	IsLocalMax []bool
+	ClusterID  []int
+}
+
+// NewGradientField returns a field of zero gradients.
+func NewGradientField(width, height int) *GradientField {
+	size := width * height
+	return &GradientField{
+		Width:      width,
+		Height:     height,
+		X:          make([]float64, size),
+		Y:          make([]float64, size),
+		Dir:        make([]uint8, size),
+		IsLocalMax: make([]bool, size),
+		ClusterID:  make([]int, size),
+	}
+}
+
+// At returns a copy of the gradient at row y and column x.
+func (f *GradientField) At(y, x int) Gradient {
+	idx := y*f.Width + x
+	return Gradient{
+		Y:          f.Y[idx],
+		X:          f.X[idx],
+		Dir:        Directions[f.Dir[idx]],
+		IsLocalMax: f.IsLocalMax[idx],
+		ClusterID:  f.ClusterID[idx],
+	}
+}
+
+// Set assigns the gradient at row y and column x. The direction is derived from its components.
+func (f *GradientField) Set(y, x int, g Gradient) {
+	idx := y*f.Width + x
+	f.setVector(idx, g.X, g.Y)
+	f.IsLocalMax[idx] = g.IsLocalMax
+	f.ClusterID[idx] = g.ClusterID
+}
+
+// Magnitude returns the magnitude of the gradient at row y and column x.
+func (f *GradientField) Magnitude(y, x int) float64 {
+	return f.magnitude(y*f.Width + x)
+}
+
+// InBound indicates whether row y and column x lie inside the field.
+func (f *GradientField) InBound(y, x int) bool {
+	return 0 <= y && y < f.Height && 0 <= x && x < f.Width
+}
+
+func (f *GradientField) magnitude(idx int) float64 {
+	return math.Sqrt(f.X[idx]*f.X[idx] + f.Y[idx]*f.Y[idx])
+}
+
+func (f *GradientField) setVector(idx int, x, y float64) {
+	f.X[idx], f.Y[idx] = x, y
+	f.Dir[idx] = directionCode(x, y)
+}
+
+// parallelRows splits rows evenly across go routines and waits for all of them to complete. The
+// last go routine takes the remaining rows.
+func parallelRows(height, numRoutines int, fn func(startRow, endRow int)) {
+	rowsPerRoutine := height / numRoutines
+
+	var wg sync.WaitGroup
+	for n := 0; n < numRoutines; n++ {
+		startRow, endRow := n*rowsPerRoutine, (n+1)*rowsPerRoutine
+		if n == numRoutines-1 {
+			endRow = height
+		}
+
+		wg.Add(1)
+		go func(startRow, endRow int) {
+			defer wg.Done()
+			fn(startRow, endRow)
+		}(startRow, endRow)
+	}
+
+	wg.Wait()
+}
@@ -0,0 +1,147 @@
+package annotate
+
+import (
+	"math"
+	"testing"
+)
+
+// matConvolve is the convolution on a matrix of rows that grids replaced, with zero border. It is
+// kept as a reference for correctness and for benchmarks.
+func matConvolve(mat [][]float64, y, x int, kernel [][]float64) (sum float64) {
+	offset := (len(kernel) - 1) / 2
+	for i := 0; i < len(kernel); i++ {
+		for j := 0; j < len(kernel); j++ {
+			row, col := y+i-offset, x+j-offset
+			if row < 0 || len(mat) <= row || col < 0 || len(mat[row]) <= col {
+				continue
+			}
+
+			sum += kernel[i][j] * mat[row][col]
+		}
+	}
+
+	return sum
+}
+
+func matGaussianMask(mat [][]float64) [][]float64 {
+	blurred := make([][]float64, len(mat))
+	for i := 0; i < len(mat); i++ {
+		blurred[i] = make([]float64, len(mat[i]))
+		for j := 0; j < len(mat[i]); j++ {
+			blurred[i][j] = matConvolve(mat, i, j, GaussKernel)
+		}
+	}
+
+	return blurred
+}
+
+func matGradientMask(mat [][]float64) [][]*Gradient {
+	gradients := make([][]*Gradient, len(mat))
+	for i := 0; i < len(mat); i++ {
+		gradients[i] = make([]*Gradient, len(mat[i]))
+		for j := 0; j < len(mat[i]); j++ {
+			gradients[i][j] = &Gradient{X: matConvolve(mat, i, j, Gx), Y: matConvolve(mat, i, j, Gy)}
+			gradients[i][j].SetDirection()
+		}
+	}
+
+	return gradients
+}
+
+func TestGrid(t *testing.T) {
+	if _, err := NewGridFromMat([][]float64{{1, 2}, {3}}); err == nil {
+		t.Error("expected ragged matrix to fail")
+	}
+
+	mat := [][]float64{{1, 2, 3}, {4, 5, 6}}
+	grid, err := NewGridFromMat(mat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if grid.Width != 3 || grid.Height != 2 || grid.At(1, 0) != 4 {
+		t.Errorf("expected 3x2 grid in row-major order, got %v", grid)
+	}
+
+	clone := grid.Clone()
+	clone.Set(1, 0, 7)
+	if grid.At(1, 0) != 4 || clone.At(1, 0) != 7 {
+		t.Error("expected clone to be independent of the grid")
+	}
+
+	if grid.InBound(2, 0) || grid.InBound(0, 3) || !grid.InBound(1, 2) {
+		t.Error("incorrect bound check")
+	}
+
+	for i, row := range grid.Mat() {
+		for j, val := range row {
+			if val != mat[i][j] {
+				t.Errorf("expected %f at (%d, %d), got %f", mat[i][j], i, j, val)
+			}
+		}
+	}
+}
+
+func TestGridMatchesMat(t *testing.T) {
+	grid := randomGrid(30, 40)
+	mat := grid.Mat()
+
+	blurred, err := GaussianMask(grid, BorderZero)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, row := range matGaussianMask(mat) {
+		for j, val := range row {
+			if math.Abs(blurred.At(i, j)-val) > 1e-12 {
+				t.Fatalf("blur differs at (%d, %d): %f != %f", i, j, blurred.At(i, j), val)
+			}
+		}
+	}
+
+	field, err := GradientMask(grid, BorderZero)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, row := range matGradientMask(mat) {
+		for j, grad := range row {
+			if got := field.At(i, j); got.X != grad.X || got.Y != grad.Y || got.Dir != grad.Dir {
+				t.Fatalf("gradient differs at (%d, %d): %v != %v", i, j, got, *grad)
+			}
+		}
+	}
+}
+
+func BenchmarkGrid(b *testing.B) {
+	grid := randomGrid(1000, 1000)
+	mat := grid.Mat()
+
+	b.Run("GaussianMask on matrix", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			matGaussianMask(mat)
+		}
+	})
+
+	b.Run("GaussianMask on grid", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			GaussianMask(grid, BorderZero)
+		}
+	})
+
+	b.Run("GradientMask on matrix", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			matGradientMask(mat)
+		}
+	})
+
+	b.Run("GradientMask on grid", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			GradientMask(grid, BorderZero)
+		}
+	})
+}
@@ -7,24 +7,10 @@ import (
 
 // ConvexHullMasking returns a boolean map with [i][j] as keys. The boolean value indicates whether
 // point at i, j is a polygon corner.
-func ConvexHullMasking(grads [][]*Gradient) map[int]map[int]bool {
+func ConvexHullMasking(field *GradientField) map[int]map[int]bool {
 	hullMask := make(map[int]map[int]bool)
 
-	clusters := make(map[int][]*Point)
-	for i := 0; i < len(grads); i++ {
-		for j := 0; j < len(grads[i]); j++ {
-			if !grads[i][j].IsLocalMax {
-				continue
-			}
-
-			if _, ok := clusters[grads[i][j].ClusterID]; !ok {
-				clusters[grads[i][j].ClusterID] = []*Point{}
-			}
-
-			clusters[grads[i][j].ClusterID] = append(clusters[grads[i][j].ClusterID], &Point{false, i, j})
-		}
-	}
-
+	clusters := GroupClusters(field)
 	for id := range clusters {
 		LabelHullVertices(clusters[id])
 
@@ -44,6 +30,24 @@ func ConvexHullMasking(grads [][]*Gradient) map[int]map[int]bool {
 	return hullMask
 }
 
+// GroupClusters collects the local maximum gradients of a labeled gradient field into lists of
+// points keyed by cluster ID. Noise edges are left out.
+func GroupClusters(field *GradientField) map[int][]*Point {
+	clusters := make(map[int][]*Point)
+	for i := 0; i < field.Height; i++ {
+		for j := 0; j < field.Width; j++ {
+			idx := i*field.Width + j
+			if !field.IsLocalMax[idx] || field.ClusterID[idx] == NoiseClusterID {
+				continue
+			}
+
+			clusters[field.ClusterID[idx]] = append(clusters[field.ClusterID[idx]], &Point{false, i, j})
+		}
+	}
+
+	return clusters
+}
+
 type Point struct {
 	IsHullVertex bool
 	Y, X         int
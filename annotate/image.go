@@ -25,222 +25,201 @@ var Colors = []color.NRGBA{
 
 // CreateFloodFillImage takes an image and applies flood fill to it. The output is an image that has
 // exterior wall dissolved.
-func CreateFloodFillImage(outputDir, imageName string, img image.Image) {
-	maxPoint := img.Bounds().Max
-	minPoint := img.Bounds().Min
-
-	pixelGrid := make([][]float64, maxPoint.Y)
-	for i := minPoint.Y; i < maxPoint.Y; i++ {
-		pixelGrid[i] = make([]float64, maxPoint.X)
-		for j := minPoint.X; j < maxPoint.X; j++ {
-			pixelGrid[i][j] = RGBTo8BitGrayScaleIntensity(img.At(j, i))
-		}
+func CreateFloodFillImage(outputDir, imageName string, img image.Image) error {
+	opts := DefaultPipelineOptions()
+	opts.FloodFillTolerance = 0.15
+	res, err := NewPipeline(opts).RunUntil(img, StageFloodFill)
+	if err != nil {
+		return err
 	}
 
-	maskedGrid := FloodFillFromTopLeftCorner(pixelGrid, 5, 0.15)
+	filename := fmt.Sprintf("%s/%s_flood_fill.png", outputDir, imageName)
+	return WritePNG(filename, DrawGrayScale(res.Bounds, res.WallRemoved))
+}
 
-	newImage := image.NewGray(img.Bounds())
-	for y := minPoint.Y; y < maxPoint.Y; y++ {
-		for x := minPoint.X; x < maxPoint.X; x++ {
-			val := maskedGrid[y][x]
-			if val < 0.0 {
-				val = 0.0
-			}
-			newImage.Set(x, y, color.Gray{uint8(val)})
-		}
+// CreateGaussianBlurImage takes an image and applies Gaussian blur to it. It outputs a blurred
+// image.
+func CreateGaussianBlurImage(outputDir, imageName string, img image.Image) error {
+	res, err := NewPipeline(DefaultPipelineOptions()).RunUntil(img, StageGaussianBlur)
+	if err != nil {
+		return err
 	}
 
-	outputFile, fileErr := os.Create(fmt.Sprintf("%s/%s_flood_fill.png", outputDir, imageName))
-	if fileErr != nil {
-		fmt.Println("Cannot create image")
-	} else {
-		png.Encode(outputFile, newImage)
-		outputFile.Close()
+	filename := fmt.Sprintf("%s/%s_gaussian_blur.png", outputDir, imageName)
+	return WritePNG(filename, DrawGrayScale(res.Bounds, res.Blurred))
+}
+
+// CreateEdgeDetectionImage takes an image and applies Canny's edge detection algorithm to it. It
+// outputs an image that has edge highlighted.
+func CreateEdgeDetectionImage(outputDir string, imageName string, img image.Image) error {
+	opts := DefaultPipelineOptions()
+	opts.NumRoutines = 32
+	res, err := NewPipeline(opts).RunUntil(img, StageEdgeDetection)
+	if err != nil {
+		return err
 	}
+
+	return WritePNG(fmt.Sprintf("%s/%s_edge_detection.png", outputDir, imageName), DrawEdges(res))
 }
 
-// CreateGaussianBlurImage takes an image and applies Gaussian blur to it. It outputs a blurred
-// image.
-func CreateGaussianBlurImage(outputDir, imageName string, img image.Image) {
-	maxPoint := img.Bounds().Max
-	minPoint := img.Bounds().Min
+// CreateClusteringImage takes an image and performs the nearest neighbor clustering algorithm to it.
+// The output is an image with different clusters where each cluster is an obstacle.
+func CreateClusteringImage(outputDir, imageName string, img image.Image) error {
+	res, err := NewPipeline(DefaultPipelineOptions()).RunUntil(img, StageClustering)
+	if err != nil {
+		return err
+	}
 
-	pixelGrid := make([][]float64, maxPoint.Y)
-	for i := minPoint.Y; i < maxPoint.Y; i++ {
-		pixelGrid[i] = make([]float64, maxPoint.X)
-		for j := minPoint.X; j < maxPoint.X; j++ {
-			pixelGrid[i][j] = RGBTo8BitGrayScaleIntensity(img.At(j, i))
-		}
+	return WritePNG(fmt.Sprintf("%s/%s_clustering.png", outputDir, imageName), DrawClusters(res))
+}
+
+// CreateConvexHullImage takes an image and performs the whole set of auto keepout algorithm to it.
+// The output is an image with obstacle groupings. The red dots represent the convex hull corners of
+// a keepout polygon.
+func CreateConvexHullImage(outputDir, imageName string, img image.Image) error {
+	res, err := NewPipeline(DefaultPipelineOptions()).Run(img)
+	if err != nil {
+		return err
 	}
 
-	wallRemovedMask := FloodFillFromTopLeftCorner(pixelGrid, 5, 0.10)
-	gaussMask := ParallelGaussianMask(wallRemovedMask, 4)
+	return WritePNG(fmt.Sprintf("%s/%s_convex_hull.png", outputDir, imageName), DrawHulls(res))
+}
 
-	newImage := image.NewGray(img.Bounds())
-	for y := minPoint.Y; y < maxPoint.Y; y++ {
-		for x := minPoint.X; x < maxPoint.X; x++ {
-			val := gaussMask[y][x]
+// DrawGrayScale renders an intensity grid as a gray scale image with the given bounds.
+func DrawGrayScale(bounds image.Rectangle, grid *Grid) *image.Gray {
+	newImage := image.NewGray(bounds)
+	for i := 0; i < grid.Height; i++ {
+		for j := 0; j < grid.Width; j++ {
+			val := grid.At(i, j)
 			if val < 0.0 {
 				val = 0.0
 			}
-			newImage.Set(x, y, color.Gray{uint8(val)})
+			newImage.Set(bounds.Min.X+j, bounds.Min.Y+i, color.Gray{uint8(val)})
 		}
 	}
 
-	outputFile, fileErr := os.Create(fmt.Sprintf("%s/%s_gaussian_blur.png", outputDir, imageName))
-	if fileErr != nil {
-		fmt.Println("Cannot create image")
-	} else {
-		png.Encode(outputFile, newImage)
-		outputFile.Close()
-	}
+	return newImage
 }
 
-// CreateEdgeDetectionImage takes an image and applies Canny's edge detection algorithm to it. It
-// outputs an image that has edge highlighted.
-func CreateEdgeDetectionImage(outputDir string, imageName string, img image.Image) {
-	maxPoint := img.Bounds().Max
-	minPoint := img.Bounds().Min
-
-	pixelGrid := make([][]float64, maxPoint.Y)
-	for i := minPoint.Y; i < maxPoint.Y; i++ {
-		pixelGrid[i] = make([]float64, maxPoint.X)
-		for j := minPoint.X; j < maxPoint.X; j++ {
-			pixelGrid[i][j] = RGBTo8BitGrayScaleIntensity(img.At(j, i))
+// DrawEdges renders the blurred image of a pipeline result with local maximum gradients highlighted
+// in red.
+func DrawEdges(res *PipelineResult) *image.NRGBA {
+	newImage := image.NewNRGBA(res.Bounds)
+	for i := 0; i < res.Gradients.Height; i++ {
+		for j := 0; j < res.Gradients.Width; j++ {
+			x, y := res.Bounds.Min.X+j, res.Bounds.Min.Y+i
+			if res.Gradients.IsLocalMax[i*res.Gradients.Width+j] {
+				newImage.Set(x, y, color.NRGBA{255, 0, 0, 255})
+			} else {
+				newImage.Set(x, y, color.Gray{uint8(res.Blurred.At(i, j))})
+			}
 		}
 	}
 
-	wallRemovedMask := FloodFillFromTopLeftCorner(pixelGrid, 5, 0.10)
-	gaussMask := ParallelGaussianMask(wallRemovedMask, 32)
-	gradMask := ParallelGradientMask(gaussMask, 32)
-	NonMaximumSuppression(gradMask, 255)
+	return newImage
+}
 
-	newImage := image.NewNRGBA(img.Bounds())
-	for y := minPoint.Y; y < maxPoint.Y; y++ {
-		for x := minPoint.X; x < maxPoint.X; x++ {
-			grad := gradMask[y][x]
-			if grad.IsLocalMax {
-				newImage.Set(x, y, color.NRGBA{255, 0, 0, 255})
+// DrawClusters renders the blurred image of a pipeline result with every cluster of local maximum
+// gradients drawn in its own color. Noise edges are not drawn.
+func DrawClusters(res *PipelineResult) *image.NRGBA {
+	newImage := image.NewNRGBA(res.Bounds)
+	for i := 0; i < res.Gradients.Height; i++ {
+		for j := 0; j < res.Gradients.Width; j++ {
+			x, y := res.Bounds.Min.X+j, res.Bounds.Min.Y+i
+			idx := i*res.Gradients.Width + j
+			if res.Gradients.IsLocalMax[idx] && res.Gradients.ClusterID[idx] != NoiseClusterID {
+				newImage.Set(x, y, Colors[res.Gradients.ClusterID[idx]%len(Colors)])
 			} else {
-				newImage.Set(x, y, color.Gray{uint8(gaussMask[y][x])})
+				val := res.Blurred.Values[idx]
+				if val < 0.0 {
+					val = 0.0
+				}
+				newImage.Set(x, y, color.NRGBA{uint8(val), uint8(val), uint8(val), 255})
 			}
 		}
 	}
 
-	outputFile, fileErr := os.Create(fmt.Sprintf("%s/%s_edge_detection.png", outputDir, imageName))
-	if fileErr != nil {
-		fmt.Println("Cannot create image")
-	} else {
-		png.Encode(outputFile, newImage)
-		outputFile.Close()
-	}
+	return newImage
 }
 
-// CreateClusteringImage takes an image and performs the nearest neighbor clustering algorithm to it.
-// The output is an image with different clusters where each cluster is an obstacle.
-func CreateClusteringImage(outputDir, imageName string, img image.Image) {
-	maxPoint := img.Bounds().Max
-	minPoint := img.Bounds().Min
-
-	pixelGrid := make([][]float64, maxPoint.Y)
-	for i := minPoint.Y; i < maxPoint.Y; i++ {
-		pixelGrid[i] = make([]float64, maxPoint.X)
-		for j := minPoint.X; j < maxPoint.X; j++ {
-			pixelGrid[i][j] = RGBTo8BitGrayScaleIntensity(img.At(j, i))
-		}
-	}
+// DrawHulls renders the clusters of a pipeline result, outlines every keepout polygon and marks its
+// vertices with red dots.
+func DrawHulls(res *PipelineResult) *image.NRGBA {
+	newImage := DrawClusters(res)
 
-	wallRemovedMask := FloodFillFromTopLeftCorner(pixelGrid, 5, 0.10)
-	gaussMask := ParallelGaussianMask(wallRemovedMask, 4)
-	gradMask := ParallelGradientMask(gaussMask, 4)
-	NonMaximumSuppression(gradMask, 255)
-	SimpleNearestNeighborClustering(gradMask, 10)
+	radius := 2
+	for _, polygon := range res.Polygons {
+		for k, vertex := range polygon.Vertices {
+			next := polygon.Vertices[(k+1)%len(polygon.Vertices)]
+			drawLine(newImage, res.Bounds.Min, vertex, next, color.NRGBA{255, 0, 0, 255})
 
-	newImage := image.NewNRGBA(img.Bounds())
-	for y := minPoint.Y; y < maxPoint.Y; y++ {
-		for x := minPoint.X; x < maxPoint.X; x++ {
-			grad := gradMask[y][x]
-			if grad.IsLocalMax {
-				newImage.Set(x, y, Colors[grad.ClusterID%len(Colors)])
-			} else {
-				val := uint8(gaussMask[y][x])
-				if val < 0 {
-					val = 0
+			i, j := res.Bounds.Min.Y+vertex.Y, res.Bounds.Min.X+vertex.X
+			for y := i - radius; y < i+radius; y++ {
+				for x := j - radius; x < j+radius; x++ {
+					newImage.Set(x, y, color.NRGBA{255, 0, 0, 255})
 				}
-				newImage.Set(x, y, color.NRGBA{val, val, val, 255})
 			}
 		}
 	}
 
-	outputFile, fileErr := os.Create(fmt.Sprintf("%s/%s_clustering.png", outputDir, imageName))
-	if fileErr != nil {
-		fmt.Println("Cannot create image")
-	} else {
-		png.Encode(outputFile, newImage)
-		outputFile.Close()
-	}
+	return newImage
 }
 
-// CreateConvexHullImage takes an image and performs the whole set of auto keepout algorithm to it.
-// The output is an image with obstacle groupings. The red dots represent the convex hull corners of
-// a keepout polygon.
-func CreateConvexHullImage(outputDir, imageName string, img image.Image) {
-	maxPoint := img.Bounds().Max
-	minPoint := img.Bounds().Min
-
-	pixelGrid := make([][]float64, maxPoint.Y)
-	for i := minPoint.Y; i < maxPoint.Y; i++ {
-		pixelGrid[i] = make([]float64, maxPoint.X)
-		for j := minPoint.X; j < maxPoint.X; j++ {
-			pixelGrid[i][j] = RGBTo8BitGrayScaleIntensity(img.At(j, i))
-		}
+// drawLine draws a straight line between two grid points using Bresenham's algorithm. The origin is
+// the image coordinate of grid point (0, 0).
+func drawLine(img *image.NRGBA, origin image.Point, from, to *Point, c color.Color) {
+	x, y := from.X, from.Y
+	dx, dy := to.X-from.X, to.Y-from.Y
+	stepX, stepY := 1, 1
+	if dx < 0 {
+		dx, stepX = -dx, -1
 	}
 
-	wallRemovedMask := FloodFillFromTopLeftCorner(pixelGrid, 5, 0.10)
-	gaussMask := ParallelGaussianMask(wallRemovedMask, 4)
-	gradMask := ParallelGradientMask(gaussMask, 4)
-	NonMaximumSuppression(gradMask, 255)
-	SimpleNearestNeighborClustering(gradMask, 10)
+	if dy < 0 {
+		dy, stepY = -dy, -1
+	}
 
-	newImage := image.NewNRGBA(img.Bounds())
-	for y := minPoint.Y; y < maxPoint.Y; y++ {
-		for x := minPoint.X; x < maxPoint.X; x++ {
-			grad := gradMask[y][x]
-			if grad.IsLocalMax {
-				newImage.Set(x, y, Colors[grad.ClusterID%len(Colors)])
-			} else {
-				val := uint8(gaussMask[y][x])
-				if val < 0 {
-					val = 0
-				}
-				newImage.Set(x, y, color.NRGBA{val, val, val, 255})
-			}
+	err := dx - dy
+	for {
+		img.Set(origin.X+x, origin.Y+y, c)
+		if x == to.X && y == to.Y {
+			return
 		}
-	}
 
-	radius := 2
+		e2 := 2 * err
+		if e2 > -dy {
+			err -= dy
+			x += stepX
+		}
 
-	hullMask := ConvexHullMasking(gradMask)
-	for i := range hullMask {
-		for j := range hullMask[i] {
-			for y := i - radius; y < i+radius; y++ {
-				for x := j - radius; x < j+radius; x++ {
-					newImage.Set(x, y, color.NRGBA{255, 0, 0, 255})
-				}
-			}
+		if e2 < dx {
+			err += dx
+			y += stepY
 		}
 	}
+}
+
+// WritePNG encodes an image as PNG into a new file.
+func WritePNG(filename string, img image.Image) error {
+	outputFile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
 
-	outputFile, fileErr := os.Create(fmt.Sprintf("%s/%s_convex_hull.png", outputDir, imageName))
-	if fileErr != nil {
-		fmt.Println("Cannot create image")
-	} else {
-		png.Encode(outputFile, newImage)
+	if err := png.Encode(outputFile, img); err != nil {
 		outputFile.Close()
+		return fmt.Errorf("failed to encode %s: %w", filename, err)
 	}
+
+	return outputFile.Close()
 }
 
-func CreateSubtractMeanImage(outputDir string, imageName string, img image.Image) {
+// CreateSubtractMeanImage subtracts the mean intensity from every pixel of an image.
+func CreateSubtractMeanImage(outputDir string, imageName string, img image.Image) error {
+	if img.Bounds().Empty() {
+		return newImageError("image %v has no pixel", img.Bounds())
+	}
+
 	maxPoint := img.Bounds().Max
 	minPoint := img.Bounds().Min
 
@@ -250,7 +229,7 @@ func CreateSubtractMeanImage(outputDir string, imageName string, img image.Image
 			mean += RGBTo8BitGrayScaleIntensity(img.At(x, y))
 		}
 	}
-	mean = mean / float64(maxPoint.Y*maxPoint.X)
+	mean = mean / float64(img.Bounds().Dx()*img.Bounds().Dy())
 
 	newImage := image.NewGray(img.Bounds())
 	for y := minPoint.Y; y < maxPoint.Y; y++ {
@@ -264,16 +243,11 @@ func CreateSubtractMeanImage(outputDir string, imageName string, img image.Image
 		}
 	}
 
-	outputFile, fileErr := os.Create(fmt.Sprintf("%s/%s_subtracted_mean.png", outputDir, imageName))
-	if fileErr != nil {
-		fmt.Println("Cannot create image")
-	} else {
-		png.Encode(outputFile, newImage)
-		outputFile.Close()
-	}
+	return WritePNG(fmt.Sprintf("%s/%s_subtracted_mean.png", outputDir, imageName), newImage)
 }
 
-func CreateColorfulImage(outputDir string, imageName string, img image.Image) {
+// CreateColorfulImage marks dark pixels of an image in red and the rest in black.
+func CreateColorfulImage(outputDir string, imageName string, img image.Image) error {
 	maxPoint := img.Bounds().Max
 	minPoint := img.Bounds().Min
 
@@ -289,11 +263,5 @@ func CreateColorfulImage(outputDir string, imageName string, img image.Image) {
 		}
 	}
 
-	outputFile, fileErr := os.Create(fmt.Sprintf("%s/%s_color.png", outputDir, imageName))
-	if fileErr != nil {
-		fmt.Println("Cannot create image")
-	} else {
-		png.Encode(outputFile, newImage)
-		outputFile.Close()
-	}
+	return WritePNG(fmt.Sprintf("%s/%s_color.png", outputDir, imageName), newImage)
 }
@@ -0,0 +1,246 @@
+package annotate
+
+import "math"
+
+// Join styles of inflated polygon corners
+const (
+	JoinMiter = "miter"
+	JoinRound = "round"
+)
+
+// MiterLimit is the longest distance from a vertex to its mitered corner as a multiple of the
+// inflation distance. Sharper corners are clipped at that distance so they still clear the vertex
+// by the inflation distance.
+const MiterLimit = 2.0
+
+// InflatePolygons offsets every polygon outward by a distance in pixels, see InflatePolygon.
+func InflatePolygons(polygons map[int]*Polygon, distance float64, join string) (map[int]*Polygon, error) {
+	inflated := make(map[int]*Polygon, len(polygons))
+	for id, polygon := range polygons {
+		var err error
+		if inflated[id], err = InflatePolygon(polygon, distance, join); err != nil {
+			return nil, err
+		}
+	}
+
+	return inflated, nil
+}
+
+// InflatePolygon offsets the edges of a counter-clockwise polygon outward by a distance in pixels.
+// Corners are either mitered or rounded, and a cluster with fewer than three vertices grows into a
+// disk, a square or a capsule around its points. The offset is traced as the union of the polygon, a
+// band along the outside of every edge and a join at every convex vertex, so it clears the polygon by
+// the distance at reflex vertices and across notches narrower than twice the distance, where the
+// offset edges would cross. Offset vertices are rounded to pixels away from the vertex they are offset
+// from. When the union cannot be traced as a simple polygon, its convex hull is returned instead.
+func InflatePolygon(polygon *Polygon, distance float64, join string) (*Polygon, error) {
+	if join != JoinMiter && join != JoinRound {
+		return nil, newParameterError("join", join, "must be miter or round")
+	}
+
+	if distance < 0 {
+		return nil, newParameterError("distance", distance, "must not be negative")
+	}
+
+	inflated := &Polygon{ClusterID: polygon.ClusterID, NumPoints: polygon.NumPoints,
+		MergedClusterIDs: polygon.MergedClusterIDs}
+	if distance == 0 || len(polygon.Vertices) == 0 {
+		inflated.Vertices = polygon.Vertices
+		return inflated, nil
+	}
+
+	var rings [][]*Point
+	if len(polygon.Vertices) == 1 {
+		rings = appendRing(rings, offsetRing(polygon.Vertices[0], inflatePoint(polygon.Vertices[0], distance, join)))
+	} else {
+		rings = inflateRings(polygon.Vertices, distance, join)
+	}
+
+	var vertices []*Point
+	if len(rings) == 1 {
+		vertices = rings[0]
+	} else if len(rings) > 1 {
+		vertices = unionOutline(rings)
+	}
+
+	if len(vertices) < 3 || !isSimplePolygon(vertices) {
+		var corners []*Point
+		for _, ring := range rings {
+			corners = append(corners, ring...)
+		}
+
+		vertices = MonotoneChainHull(corners)
+	}
+
+	inflated.Vertices = vertices
+	return inflated, nil
+}
+
+// inflateRings returns counter-clockwise rings in (X, Y) coordinates whose union is the offset of a
+// closed polygon: the polygon itself, a band along the outside of every edge and a join at every
+// convex vertex. Reflex and straight vertices are covered by the bands of their edges. Two vertices
+// are treated as a polygon that goes back and forth along a segment.
+func inflateRings(vertices []*Point, distance float64, join string) [][]*Point {
+	var rings [][]*Point
+	if len(vertices) >= 3 {
+		rings = append(rings, vertices)
+	}
+
+	for i, vertex := range vertices {
+		prev, next := vertices[(i+len(vertices)-1)%len(vertices)], vertices[(i+1)%len(vertices)]
+		u1, u2 := unitVector(prev, vertex), unitVector(vertex, next)
+
+		// Outward normals are on the right of the edges of a counter-clockwise polygon.
+		n1, n2 := [2]float64{u1[1], -u1[0]}, [2]float64{u2[1], -u2[0]}
+		x, y := float64(vertex.X), float64(vertex.Y)
+		nextX, nextY := float64(next.X), float64(next.Y)
+
+		band := []*Point{vertex, offsetVertex(vertex, x+distance*n2[0], y+distance*n2[1]),
+			offsetVertex(next, nextX+distance*n2[0], nextY+distance*n2[1]), next}
+		rings = appendRing(rings, band)
+
+		turn := u1[0]*u2[1] - u1[1]*u2[0]
+		dot := u1[0]*u2[0] + u1[1]*u2[1]
+		if turn < 0 || (turn == 0 && dot > 0) {
+			continue
+		}
+
+		angle := math.Atan2(turn, dot)
+		var offset [][2]float64
+		switch {
+		case join == JoinRound:
+			start := math.Atan2(n1[1], n1[0])
+			steps := arcSteps(angle, distance)
+			for k := 0; k <= steps; k++ {
+				sin, cos := math.Sincos(start + angle*float64(k)/float64(steps))
+				offset = append(offset, [2]float64{x + distance*cos, y + distance*sin})
+			}
+		case 1/math.Cos(angle/2) <= MiterLimit:
+			scale := distance / (1 + n1[0]*n2[0] + n1[1]*n2[1])
+			offset = append(offset, [2]float64{x + distance*n1[0], y + distance*n1[1]},
+				[2]float64{x + scale*(n1[0]+n2[0]), y + scale*(n1[1]+n2[1])},
+				[2]float64{x + distance*n2[0], y + distance*n2[1]})
+		default:
+			// Clip the miter with a line across the bisector at the miter limit.
+			m := [2]float64{n1[0] + n2[0], n1[1] + n2[1]}
+			if norm := math.Hypot(m[0], m[1]); norm > 1e-12 {
+				m[0], m[1] = m[0]/norm, m[1]/norm
+			} else {
+				m = u1
+			}
+
+			limit := MiterLimit * distance
+			s1 := (limit - distance*(n1[0]*m[0]+n1[1]*m[1])) / (u1[0]*m[0] + u1[1]*m[1])
+			s2 := (limit - distance*(n2[0]*m[0]+n2[1]*m[1])) / (u2[0]*m[0] + u2[1]*m[1])
+			offset = append(offset, [2]float64{x + distance*n1[0], y + distance*n1[1]},
+				[2]float64{x + distance*n1[0] + s1*u1[0], y + distance*n1[1] + s1*u1[1]},
+				[2]float64{x + distance*n2[0] + s2*u2[0], y + distance*n2[1] + s2*u2[1]},
+				[2]float64{x + distance*n2[0], y + distance*n2[1]})
+		}
+
+		rings = appendRing(rings, append([]*Point{vertex}, offsetRing(vertex, offset)...))
+	}
+
+	return rings
+}
+
+// appendRing appends a ring without its repeated vertices, unless rounding flattened it.
+func appendRing(rings [][]*Point, vertices []*Point) [][]*Point {
+	ring := make([]*Point, 0, len(vertices))
+	for _, point := range vertices {
+		if last := len(ring) - 1; last >= 0 && ring[last].X == point.X && ring[last].Y == point.Y {
+			continue
+		}
+
+		ring = append(ring, point)
+	}
+
+	if len(ring) > 1 && ring[0].X == ring[len(ring)-1].X && ring[0].Y == ring[len(ring)-1].Y {
+		ring = ring[:len(ring)-1]
+	}
+
+	if ring = dropCollinear(ring); len(ring) < 3 || signedArea(ring) <= 0 {
+		return rings
+	}
+
+	return append(rings, ring)
+}
+
+// offsetRing rounds positions offset from a vertex, see offsetVertex.
+func offsetRing(vertex *Point, offset [][2]float64) []*Point {
+	ring := make([]*Point, len(offset))
+	for k, pos := range offset {
+		ring[k] = offsetVertex(vertex, pos[0], pos[1])
+	}
+
+	return ring
+}
+
+// offsetVertex rounds a position offset from a vertex to the pixel away from the vertex, so that
+// rounding never brings the offset closer.
+func offsetVertex(vertex *Point, x, y float64) *Point {
+	return &Point{Y: roundAway(y, float64(vertex.Y)), X: roundAway(x, float64(vertex.X))}
+}
+
+// inflatePoint returns a disk or a square around a single point.
+func inflatePoint(point *Point, distance float64, join string) [][2]float64 {
+	x, y := float64(point.X), float64(point.Y)
+	if join == JoinMiter {
+		return [][2]float64{{x - distance, y - distance}, {x + distance, y - distance}, {x + distance, y + distance},
+			{x - distance, y + distance}}
+	}
+
+	steps := arcSteps(2*math.Pi, distance)
+	offset := make([][2]float64, steps)
+	for k := 0; k < steps; k++ {
+		sin, cos := math.Sincos(2 * math.Pi * float64(k) / float64(steps))
+		offset[k] = [2]float64{x + distance*cos, y + distance*sin}
+	}
+
+	return offset
+}
+
+// arcSteps returns the number of chords that approximate an arc within half a pixel.
+func arcSteps(angle, radius float64) int {
+	step := math.Pi / 2
+	if radius > 0.5 {
+		step = math.Min(step, 2*math.Acos(1-0.5/radius))
+	}
+
+	return max(1, int(math.Ceil(angle/step)))
+}
+
+func unitVector(from, to *Point) [2]float64 {
+	dx, dy := float64(to.X-from.X), float64(to.Y-from.Y)
+	norm := math.Hypot(dx, dy)
+	return [2]float64{dx / norm, dy / norm}
+}
+
+// isSimplePolygon indicates whether the edges of a closed polygon only meet at shared vertices.
+func isSimplePolygon(vertices []*Point) bool {
+	n := len(vertices)
+	if n < 3 {
+		return true
+	}
+
+	for i := 0; i < n; i++ {
+		a, b := vertices[i], vertices[(i+1)%n]
+		for j := i + 1; j < n; j++ {
+			c, d := vertices[j], vertices[(j+1)%n]
+			switch {
+			case j == i+1:
+				if overlapsFrom(b, a, d) {
+					return false
+				}
+			case i == 0 && j == n-1:
+				if overlapsFrom(a, b, c) {
+					return false
+				}
+			case segmentsIntersect(a, b, c, d):
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,216 @@
+package annotate
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// boundaryDistance returns the distance from a point to the closest edge of a closed polygon.
+func boundaryDistance(vertices []*Point, point *Point) float64 {
+	dist := math.Inf(1)
+	for i, vertex := range vertices {
+		dist = math.Min(dist, segmentDistance(point, vertex, vertices[(i+1)%len(vertices)]))
+	}
+
+	return dist
+}
+
+func TestInflatePolygon(t *testing.T) {
+	square := &Polygon{ClusterID: 3, NumPoints: 40, Vertices: []*Point{{false, 0, 0}, {false, 0, 10}, {false, 10, 10},
+		{false, 10, 0}}}
+	if signedArea(square.Vertices) <= 0 {
+		t.Fatal("expected square vertices to be counter-clockwise")
+	}
+
+	t.Run("MiterSquare", func(t *testing.T) {
+		inflated, err := InflatePolygon(square, 2, JoinMiter)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if inflated.ClusterID != 3 || inflated.NumPoints != 40 {
+			t.Errorf("expected cluster ID and point count to be kept, got %d and %d", inflated.ClusterID,
+				inflated.NumPoints)
+		}
+
+		if len(inflated.Vertices) != 4 || inflated.Area() != 196 {
+			t.Errorf("expected a 14x14 square, got %v", inflated.Vertices)
+		}
+	})
+
+	t.Run("RoundSquare", func(t *testing.T) {
+		inflated, err := InflatePolygon(square, 5, JoinRound)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Straight sides are pushed out by the distance and corners become quarter disks.
+		expected := 100 + 4*10*5 + math.Pi*25
+		if math.Abs(inflated.Area()-expected) > 0.05*expected {
+			t.Errorf("expected area close to %f, got %f", expected, inflated.Area())
+		}
+
+		for _, vertex := range inflated.Vertices {
+			if dist := boundaryDistance(square.Vertices, vertex); math.Abs(dist-5) > 1 {
+				t.Errorf("expected vertex %v to be 5 pixels away from the square, got %f", vertex, dist)
+			}
+		}
+	})
+
+	t.Run("ConcaveShape", func(t *testing.T) {
+		polygon := &Polygon{Vertices: ConcaveHull(lShape(), 1, 0)}
+		inflated, err := InflatePolygon(polygon, 2, JoinMiter)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The L grows into a 44x14 bar and a 14x30 arm.
+		if inflated.Area() != 44*14+14*30 {
+			t.Errorf("expected area %d, got %f with vertices %v", 44*14+14*30, inflated.Area(), inflated.Vertices)
+		}
+
+		if !insidePolygon(inflated.Vertices, &Point{false, 12, 12}) || insidePolygon(inflated.Vertices,
+			&Point{false, 13, 13}) {
+			t.Error("expected the notch of the L to shrink by the distance")
+		}
+	})
+
+	t.Run("DeepNotch", func(t *testing.T) {
+		// A U shape with a notch 4 pixels wide, which an offset of 5 pixels closes.
+		u := &Polygon{Vertices: []*Point{{false, 0, 0}, {false, 0, 10}, {false, 20, 10}, {false, 20, 7},
+			{false, 5, 7}, {false, 5, 3}, {false, 20, 3}, {false, 20, 0}}}
+		if signedArea(u.Vertices) <= 0 {
+			t.Fatal("expected U vertices to be counter-clockwise")
+		}
+
+		inflated, err := InflatePolygon(u, 5, JoinMiter)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !isSimplePolygon(inflated.Vertices) || signedArea(inflated.Vertices) <= 0 {
+			t.Errorf("expected a simple counter-clockwise polygon, got %v", inflated.Vertices)
+		}
+
+		for _, vertex := range u.Vertices {
+			if !insidePolygon(inflated.Vertices, vertex) {
+				t.Errorf("expected %v to be inside the inflated polygon", vertex)
+			}
+		}
+	})
+
+	t.Run("DegenerateClusters", func(t *testing.T) {
+		point := &Polygon{Vertices: []*Point{{false, 5, 5}}}
+		disk, err := InflatePolygon(point, 10, JoinRound)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Rounding away from the center grows the radius by under a pixel.
+		if area := disk.Area(); area < 0.95*math.Pi*100 || area > math.Pi*121 {
+			t.Errorf("expected a disk of radius 10, got area %f", area)
+		}
+
+		segment := &Polygon{Vertices: []*Point{{false, 0, 0}, {false, 0, 20}}}
+		capsule, err := InflatePolygon(segment, 3, JoinRound)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := 20*6 + math.Pi*9; math.Abs(capsule.Area()-expected) > 0.1*expected {
+			t.Errorf("expected a capsule of area close to %f, got %f", expected, capsule.Area())
+		}
+
+		if !isSimplePolygon(capsule.Vertices) || signedArea(capsule.Vertices) <= 0 {
+			t.Errorf("expected a simple counter-clockwise capsule, got %v", capsule.Vertices)
+		}
+	})
+
+	t.Run("InvalidParameters", func(t *testing.T) {
+		var paramErr ParameterError
+		if _, err := InflatePolygon(square, -1, JoinRound); !errors.As(err, &paramErr) || paramErr.Name != "distance" {
+			t.Errorf("expected negative distance to fail with a parameter error, got %v", err)
+		}
+
+		if _, err := InflatePolygon(square, 1, "bevel"); !errors.As(err, &paramErr) || paramErr.Name != "join" {
+			t.Errorf("expected unknown join to fail with a parameter error, got %v", err)
+		}
+	})
+}
+
+func TestInflatePolygonClearance(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	hulls := map[string]func([]*Point) []*Point{
+		"Convex":  MonotoneChainHull,
+		"Concave": func(points []*Point) []*Point { return ConcaveHull(points, 1, 0) },
+	}
+
+	for name, hull := range hulls {
+		t.Run(name, func(t *testing.T) {
+			for trial := 0; trial < 100; trial++ {
+				// Scattered blobs make concave hulls with notches and reflex vertices of every angle.
+				var points []*Point
+				for blob := 0; blob < 1+rng.Intn(4); blob++ {
+					y, x := rng.Intn(40), rng.Intn(40)
+					for k := 0; k < 5+rng.Intn(20); k++ {
+						points = append(points, &Point{false, y + rng.Intn(9), x + rng.Intn(9)})
+					}
+				}
+
+				polygon := &Polygon{Vertices: hull(points)}
+				distance := 0.5 + rng.Float64()*8
+				join := []string{JoinMiter, JoinRound}[rng.Intn(2)]
+				inflated, err := InflatePolygon(polygon, distance, join)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !isSimplePolygon(inflated.Vertices) || signedArea(inflated.Vertices) <= 0 {
+					t.Fatalf("expected a simple counter-clockwise polygon, got %v", inflated.Vertices)
+				}
+
+				for _, point := range points {
+					if !insidePolygon(inflated.Vertices, point) ||
+						boundaryDistance(inflated.Vertices, point) < distance-1 {
+						t.Fatalf("expected %v to be %f pixels inside the %s inflation of %v, got %v", point,
+							distance, join, polygon.Vertices, inflated.Vertices)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPipelineInflation(t *testing.T) {
+	opts := DefaultPipelineOptions()
+	res, err := NewPipeline(opts).Run(squareImage(100, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts.InflationDistance = 4
+	inflated, err := NewPipeline(opts).Run(squareImage(100, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, polygon := range res.Polygons {
+		if inflated.Polygons[id].Area() <= polygon.Area() {
+			t.Errorf("expected polygon of cluster %d to grow, got area %f from %f", id, inflated.Polygons[id].Area(),
+				polygon.Area())
+		}
+
+		for _, vertex := range polygon.Vertices {
+			if !insidePolygon(inflated.Polygons[id].Vertices, vertex) {
+				t.Errorf("expected %v to be inside the inflated polygon of cluster %d", vertex, id)
+			}
+		}
+	}
+
+	opts.InflationCoordinates = MapCoordinates
+	if _, err := NewPipeline(opts).Run(squareImage(100, 30)); err == nil {
+		t.Error("expected a distance in metres to require a map")
+	}
+}
@@ -0,0 +1,277 @@
+package annotate
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Occupancy values of a thresholded map, they follow the convention of map_server saved maps.
+const (
+	OccupiedVal = 0
+	UnknownVal  = 205
+	FreeVal     = 254
+)
+
+// Map modes supported by map_server.
+const (
+	ModeTrinary = "trinary"
+	ModeScale   = "scale"
+	ModeRaw     = "raw"
+)
+
+// MapMetadata is the content of a ROS map_server YAML file.
+type MapMetadata struct {
+	Image          string
+	Resolution     float64
+	Origin         [3]float64
+	Negate         bool
+	OccupiedThresh float64
+	FreeThresh     float64
+	Mode           string
+}
+
+// Map is an occupancy grid loaded from a map_server YAML file along with its map frame.
+type Map struct {
+	Name     string
+	Metadata *MapMetadata
+	Image    *image.Gray
+	Frame    *MapFrame
+}
+
+// LoadMap reads a map_server YAML file, decodes the image it refers to and applies the occupancy
+// thresholds. Relative image paths are resolved against the directory of the YAML file.
+func LoadMap(yamlPath string) (*Map, error) {
+	yamlFile, err := os.Open(yamlPath)
+	if err != nil {
+		return nil, err
+	}
+	defer yamlFile.Close()
+
+	meta, err := ParseMapMetadata(yamlFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", yamlPath, err)
+	}
+
+	imagePath := meta.Image
+	if !filepath.IsAbs(imagePath) {
+		imagePath = filepath.Join(filepath.Dir(yamlPath), imagePath)
+	}
+
+	imageFile, err := os.Open(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer imageFile.Close()
+
+	img, _, err := image.Decode(imageFile)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", imagePath, err)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(yamlPath), filepath.Ext(yamlPath))
+	return NewMap(name, meta, img), nil
+}
+
+// NewMap applies the occupancy thresholds of the metadata to an image and creates a map.
+func NewMap(name string, meta *MapMetadata, img image.Image) *Map {
+	thresholded := ApplyOccupancyThresholds(img, meta)
+	return &Map{
+		Name:     name,
+		Metadata: meta,
+		Image:    thresholded,
+		Frame: &MapFrame{
+			Resolution: meta.Resolution,
+			Origin:     meta.Origin,
+			Height:     thresholded.Bounds().Dy(),
+		},
+	}
+}
+
+// ParseMapMetadata parses a map_server YAML file. Only the flat key-value subset of YAML used by
+// map_server is supported.
+func ParseMapMetadata(r io.Reader) (*MapMetadata, error) {
+	meta := &MapMetadata{
+		OccupiedThresh: 0.65,
+		FreeThresh:     0.196,
+		Mode:           ModeTrinary,
+	}
+
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		sep := strings.Index(line, ":")
+		if sep < 0 {
+			return nil, newImageError("line %d: expected key: value", lineNum)
+		}
+
+		key := strings.TrimSpace(line[:sep])
+		val := strings.Trim(strings.TrimSpace(line[sep+1:]), `"'`)
+		seen[key] = true
+
+		var err error
+		switch key {
+		case "image":
+			meta.Image = val
+		case "resolution":
+			meta.Resolution, err = strconv.ParseFloat(val, 64)
+		case "origin":
+			meta.Origin, err = parseOrigin(val)
+		case "negate":
+			var negate int
+			negate, err = strconv.Atoi(val)
+			meta.Negate = negate != 0
+		case "occupied_thresh":
+			meta.OccupiedThresh, err = strconv.ParseFloat(val, 64)
+		case "free_thresh":
+			meta.FreeThresh, err = strconv.ParseFloat(val, 64)
+		case "mode":
+			meta.Mode = val
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid %s %q: %w", lineNum, key, val, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, key := range []string{"image", "resolution", "origin"} {
+		if !seen[key] {
+			return nil, newImageError("missing required key %s", key)
+		}
+	}
+
+	if meta.Resolution <= 0 {
+		return nil, newImageError("resolution must be positive, got %v", meta.Resolution)
+	}
+
+	if meta.Mode != ModeTrinary && meta.Mode != ModeScale && meta.Mode != ModeRaw {
+		return nil, newImageError("unsupported mode %s", meta.Mode)
+	}
+
+	return meta, nil
+}
+
+// parseOrigin parses a YAML flow sequence of the form [x, y, yaw].
+func parseOrigin(val string) (origin [3]float64, err error) {
+	if !strings.HasPrefix(val, "[") || !strings.HasSuffix(val, "]") {
+		return origin, newImageError("origin must be a sequence")
+	}
+
+	fields := strings.Split(val[1:len(val)-1], ",")
+	if len(fields) != 3 {
+		return origin, newImageError("origin must have 3 elements")
+	}
+
+	for i, field := range fields {
+		if origin[i], err = strconv.ParseFloat(strings.TrimSpace(field), 64); err != nil {
+			return origin, err
+		}
+	}
+
+	return origin, nil
+}
+
+// ApplyOccupancyThresholds converts an image into occupied, free and unknown pixels the same way
+// map_server does. In raw mode, the gray scale intensity is kept as is. In scale mode, pixels that
+// are neither occupied nor free keep a value that is proportional to their occupancy.
+func ApplyOccupancyThresholds(img image.Image, meta *MapMetadata) *image.Gray {
+	bounds := img.Bounds()
+	thresholded := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			intensity := RGBTo8BitGrayScaleIntensity(img.At(bounds.Min.X+x, bounds.Min.Y+y))
+			if meta.Mode == ModeRaw {
+				thresholded.SetGray(x, y, color.Gray{uint8(math.Round(intensity))})
+				continue
+			}
+
+			occupancy := (255 - intensity) / 255
+			if meta.Negate {
+				occupancy = intensity / 255
+			}
+
+			var val uint8
+			switch {
+			case occupancy > meta.OccupiedThresh:
+				val = OccupiedVal
+			case occupancy < meta.FreeThresh:
+				val = FreeVal
+			case meta.Mode == ModeScale:
+				val = uint8(math.Round(FreeVal * (1 - occupancy)))
+			default:
+				val = UnknownVal
+			}
+
+			thresholded.SetGray(x, y, color.Gray{val})
+		}
+	}
+
+	return thresholded
+}
+
+// WorldPoint is a point in the map frame measured in metres.
+type WorldPoint struct {
+	X, Y float64
+}
+
+// MapFrame relates pixel coordinates of a map image to the map frame. Image rows grow downward
+// while the map frame Y axis points up, and the origin is the pose of the bottom-left pixel.
+type MapFrame struct {
+	Resolution float64
+	Origin     [3]float64
+	Height     int
+}
+
+// ToWorld returns the map frame position of the center of a pixel.
+func (f *MapFrame) ToWorld(p *Point) WorldPoint {
+	mx := (float64(p.X) + 0.5) * f.Resolution
+	my := (float64(f.Height-p.Y) - 0.5) * f.Resolution
+	sin, cos := math.Sincos(f.Origin[2])
+
+	return WorldPoint{
+		X: f.Origin[0] + mx*cos - my*sin,
+		Y: f.Origin[1] + mx*sin + my*cos,
+	}
+}
+
+// PolygonToWorld returns the vertices of a polygon in the map frame. Flipping the Y axis reverses
+// the winding, so vertices are reordered to stay counter-clockwise in the map frame.
+func (f *MapFrame) PolygonToWorld(p *Polygon) []WorldPoint {
+	vertices := make([]WorldPoint, len(p.Vertices))
+	for i, vertex := range p.Vertices {
+		vertices[len(vertices)-1-i] = f.ToWorld(vertex)
+	}
+
+	return vertices
+}
+
+// Area returns the area of a polygon in square metres.
+func (f *MapFrame) Area(p *Polygon) float64 {
+	return p.Area() * f.Resolution * f.Resolution
+}
+
+// Perimeter returns the perimeter of a polygon in metres.
+func (f *MapFrame) Perimeter(p *Polygon) float64 {
+	return p.Perimeter() * f.Resolution
+}
@@ -0,0 +1,137 @@
+package annotate
+
+import (
+	"errors"
+	"image"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecodePGM(t *testing.T) {
+	t.Run("Plain", func(t *testing.T) {
+		img, err := DecodePGM(strings.NewReader("P2\n# comment\n3 2\n15\n0 5 15\n15 10 0\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []uint8{0, 85, 255, 255, 170, 0}
+		for i, val := range img.(*image.Gray).Pix {
+			if val != expected[i] {
+				t.Errorf("expected pixel %d to be %d, got %d", i, expected[i], val)
+			}
+		}
+	})
+
+	t.Run("Binary", func(t *testing.T) {
+		img, _, err := image.Decode(strings.NewReader("P5 2 2 255\n\x00\x0a\xcd\xfe"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []uint8{0, 10, 205, 254}
+		for i, val := range img.(*image.Gray).Pix {
+			if val != expected[i] {
+				t.Errorf("expected pixel %d to be %d, got %d", i, expected[i], val)
+			}
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		if _, err := DecodePGM(strings.NewReader("P5 2 2 255\n\x00")); !errors.Is(err, io.EOF) {
+			t.Errorf("expected truncated raster to fail with EOF, got %v", err)
+		}
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		var imageErr ImageError
+		if _, err := DecodePGM(strings.NewReader("P6 2 2 255\n")); !errors.As(err, &imageErr) {
+			t.Errorf("expected unsupported magic number to fail with an image error, got %v", err)
+		}
+	})
+}
+
+func TestLoadMap(t *testing.T) {
+	dir := t.TempDir()
+	yaml := "image: office.pgm\nresolution: 0.05 # metres per pixel\norigin: [-1.0, 2.0, 0.0]\n" +
+		"negate: 0\noccupied_thresh: 0.65\nfree_thresh: 0.196\n"
+	if err := os.WriteFile(filepath.Join(dir, "office.yaml"), []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "office.pgm"), []byte("P5 2 2 255\n\x00\x80\xcd\xff"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := LoadMap(filepath.Join(dir, "office.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Name != "office" {
+		t.Errorf("expected map name office, got %s", m.Name)
+	}
+
+	expected := []uint8{OccupiedVal, UnknownVal, UnknownVal, FreeVal}
+	for i, val := range m.Image.Pix {
+		if val != expected[i] {
+			t.Errorf("expected pixel %d to be %d, got %d", i, expected[i], val)
+		}
+	}
+
+	// Bottom-left pixel center is half a pixel away from the origin.
+	world := m.Frame.ToWorld(&Point{Y: 1, X: 0})
+	if math.Abs(world.X+0.975) > 1e-9 || math.Abs(world.Y-2.025) > 1e-9 {
+		t.Errorf("incorrect world coordinate %v", world)
+	}
+
+	polygon := &Polygon{Vertices: MonotoneChainHull([]*Point{{Y: 0, X: 0}, {Y: 0, X: 1}, {Y: 1, X: 1}})}
+	vertices := m.Frame.PolygonToWorld(polygon)
+	var doubleArea float64
+	for i := range vertices {
+		a, b := vertices[i], vertices[(i+1)%len(vertices)]
+		doubleArea += a.X*b.Y - b.X*a.Y
+	}
+
+	if doubleArea <= 0 {
+		t.Error("expected world polygon to be counter-clockwise")
+	}
+
+	if math.Abs(m.Frame.Area(polygon)-0.00125) > 1e-12 {
+		t.Errorf("expected area 0.00125, got %f", m.Frame.Area(polygon))
+	}
+}
+
+func TestParseMapMetadata(t *testing.T) {
+	if _, err := ParseMapMetadata(strings.NewReader("image: a.pgm\norigin: [0, 0, 0]\n")); err == nil {
+		t.Error("expected missing resolution to fail")
+	}
+
+	// A bad map file is a data problem rather than a bad parameter.
+	for _, yaml := range []string{
+		"image: a.pgm\norigin: [0, 0, 0]\n",
+		"image: a.pgm\nresolution: 0\norigin: [0, 0, 0]\n",
+		"image: a.pgm\nresolution: 0.1\norigin: [0, 0, 0]\nmode: gray\n",
+		"image: a.pgm\nresolution: 0.1\norigin: [0, 0]\n",
+		"image a.pgm\n",
+	} {
+		var imageErr ImageError
+		var paramErr ParameterError
+		_, err := ParseMapMetadata(strings.NewReader(yaml))
+		if !errors.As(err, &imageErr) || errors.As(err, &paramErr) {
+			t.Errorf("expected an image error for %q, got %v", yaml, err)
+		}
+	}
+
+	meta, err := ParseMapMetadata(strings.NewReader("image: a.pgm\nresolution: 0.1\norigin: [0, 0, 0]\nnegate: 1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !meta.Negate || meta.Mode != ModeTrinary {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+}
@@ -0,0 +1,332 @@
+package annotate
+
+import "math"
+
+// Shapes of structuring elements
+const (
+	// ElementSquare covers every pixel within the radius along both axes.
+	ElementSquare = "square"
+	// ElementCross covers the pixels within the radius on the row and the column of the center.
+	ElementCross = "cross"
+	// ElementDisk covers the pixels within the radius in Euclidean distance.
+	ElementDisk = "disk"
+)
+
+// Morphological operations
+const (
+	// MorphDilate grows bright regions.
+	MorphDilate = "dilate"
+	// MorphErode shrinks bright regions.
+	MorphErode = "erode"
+	// MorphOpen erodes then dilates, which removes bright specks smaller than the element.
+	MorphOpen = "open"
+	// MorphClose dilates then erodes, which fills dark gaps narrower than the element.
+	MorphClose = "close"
+)
+
+// StructuringElement is the neighborhood that morphological operations take the maximum or the
+// minimum over. Elements are symmetric around their center.
+type StructuringElement struct {
+	Shape  string
+	Radius int
+	// Offsets are the [row, col] steps from the center to every pixel of the element.
+	Offsets [][2]int
+}
+
+// NewStructuringElement returns a square, cross or disk element. A radius of zero is the center pixel
+// alone and leaves images unchanged.
+func NewStructuringElement(shape string, radius int) (*StructuringElement, error) {
+	if radius < 0 {
+		return nil, newParameterError("radius", radius, "must not be negative")
+	}
+
+	var inside func(dy, dx int) bool
+	switch shape {
+	case ElementSquare:
+		inside = func(dy, dx int) bool { return true }
+	case ElementCross:
+		inside = func(dy, dx int) bool { return dy == 0 || dx == 0 }
+	case ElementDisk:
+		inside = func(dy, dx int) bool { return dy*dy+dx*dx <= radius*radius }
+	default:
+		return nil, newParameterError("shape", shape, "must be square, cross or disk")
+	}
+
+	element := &StructuringElement{Shape: shape, Radius: radius}
+	for dy := -radius; dy <= radius; dy++ {
+		for dx := -radius; dx <= radius; dx++ {
+			if inside(dy, dx) {
+				element.Offsets = append(element.Offsets, [2]int{dy, dx})
+			}
+		}
+	}
+
+	return element, nil
+}
+
+// lines splits the element into a horizontal and a vertical line when it is a square, since dilating
+// by both lines in turn equals dilating by the square at a fraction of the cost.
+func (e *StructuringElement) lines() []*StructuringElement {
+	if e.Shape != ElementSquare || e.Radius == 0 {
+		return []*StructuringElement{e}
+	}
+
+	horizontal := &StructuringElement{Radius: e.Radius}
+	vertical := &StructuringElement{Radius: e.Radius}
+	for d := -e.Radius; d <= e.Radius; d++ {
+		horizontal.Offsets = append(horizontal.Offsets, [2]int{0, d})
+		vertical.Offsets = append(vertical.Offsets, [2]int{d, 0})
+	}
+
+	return []*StructuringElement{horizontal, vertical}
+}
+
+// Mask is a binary image stored contiguously in row-major order like Grid.
+type Mask struct {
+	Width  int
+	Height int
+	Values []bool
+}
+
+// NewMask returns a mask with no pixel set.
+func NewMask(width, height int) *Mask {
+	return &Mask{
+		Width:  width,
+		Height: height,
+		Values: make([]bool, width*height),
+	}
+}
+
+// At indicates whether the pixel at row y and column x is set.
+func (m *Mask) At(y, x int) bool {
+	return m.Values[y*m.Width+x]
+}
+
+// Set assigns the pixel at row y and column x.
+func (m *Mask) Set(y, x int, val bool) {
+	m.Values[y*m.Width+x] = val
+}
+
+// Dilate replaces every pixel of a grayscale image with the maximum over the element around it.
+// Pixels outside of the image are ignored.
+func Dilate(grid *Grid, element *StructuringElement) (*Grid, error) {
+	if err := validateMorphology(grid, element); err != nil {
+		return nil, err
+	}
+
+	return dilateGrid(grid, element), nil
+}
+
+// Erode replaces every pixel of a grayscale image with the minimum over the element around it.
+// Pixels outside of the image are ignored.
+func Erode(grid *Grid, element *StructuringElement) (*Grid, error) {
+	if err := validateMorphology(grid, element); err != nil {
+		return nil, err
+	}
+
+	return erodeGrid(grid, element), nil
+}
+
+// Open erodes then dilates a grayscale image, which removes bright features smaller than the element
+// and keeps larger ones in place.
+func Open(grid *Grid, element *StructuringElement) (*Grid, error) {
+	if err := validateMorphology(grid, element); err != nil {
+		return nil, err
+	}
+
+	return dilateGrid(erodeGrid(grid, element), element), nil
+}
+
+// Close dilates then erodes a grayscale image, which fills dark features smaller than the element,
+// such as gaps between bright regions.
+func Close(grid *Grid, element *StructuringElement) (*Grid, error) {
+	if err := validateMorphology(grid, element); err != nil {
+		return nil, err
+	}
+
+	return erodeGrid(dilateGrid(grid, element), element), nil
+}
+
+// Morph applies one of MorphDilate, MorphErode, MorphOpen or MorphClose to a grayscale image.
+func Morph(grid *Grid, operation string, element *StructuringElement) (*Grid, error) {
+	switch operation {
+	case MorphDilate:
+		return Dilate(grid, element)
+	case MorphErode:
+		return Erode(grid, element)
+	case MorphOpen:
+		return Open(grid, element)
+	case MorphClose:
+		return Close(grid, element)
+	default:
+		return nil, newParameterError("operation", operation, "must be dilate, erode, open or close")
+	}
+}
+
+// DilateMask sets every pixel of a binary image that has a set pixel within the element around it.
+func DilateMask(mask *Mask, element *StructuringElement) (*Mask, error) {
+	if err := validateMaskMorphology(mask, element); err != nil {
+		return nil, err
+	}
+
+	return dilateMask(mask, element), nil
+}
+
+// ErodeMask keeps the pixels of a binary image whose element around them is entirely set. Pixels
+// outside of the image count as set, so regions touching the border are not eroded from it.
+func ErodeMask(mask *Mask, element *StructuringElement) (*Mask, error) {
+	if err := validateMaskMorphology(mask, element); err != nil {
+		return nil, err
+	}
+
+	return erodeMask(mask, element), nil
+}
+
+// OpenMask erodes then dilates a binary image, which removes set specks smaller than the element.
+func OpenMask(mask *Mask, element *StructuringElement) (*Mask, error) {
+	if err := validateMaskMorphology(mask, element); err != nil {
+		return nil, err
+	}
+
+	return dilateMask(erodeMask(mask, element), element), nil
+}
+
+// CloseMask dilates then erodes a binary image, which fills unset gaps narrower than the element.
+func CloseMask(mask *Mask, element *StructuringElement) (*Mask, error) {
+	if err := validateMaskMorphology(mask, element); err != nil {
+		return nil, err
+	}
+
+	return erodeMask(dilateMask(mask, element), element), nil
+}
+
+func validateMorphology(grid *Grid, element *StructuringElement) error {
+	if err := validateGrid(grid); err != nil {
+		return err
+	}
+
+	return validateElement(element)
+}
+
+func validateMaskMorphology(mask *Mask, element *StructuringElement) error {
+	if mask == nil || mask.Width <= 0 || mask.Height <= 0 {
+		return newImageError("mask has no pixel")
+	}
+
+	if len(mask.Values) != mask.Width*mask.Height {
+		return newImageError("mask has %d values instead of %d", len(mask.Values), mask.Width*mask.Height)
+	}
+
+	return validateElement(element)
+}
+
+func validateElement(element *StructuringElement) error {
+	if element == nil || len(element.Offsets) == 0 {
+		return newParameterError("element", "empty", "must have at least one offset")
+	}
+
+	return nil
+}
+
+// dilateGrid takes the maximum over the element, one line at a time for a square.
+func dilateGrid(grid *Grid, element *StructuringElement) *Grid {
+	for _, line := range element.lines() {
+		dilated := NewGrid(grid.Width, grid.Height)
+		for i := 0; i < grid.Height; i++ {
+			for j := 0; j < grid.Width; j++ {
+				val := math.Inf(-1)
+				for _, offset := range line.Offsets {
+					if y, x := i+offset[0], j+offset[1]; grid.InBound(y, x) {
+						val = max(val, grid.At(y, x))
+					}
+				}
+				dilated.Set(i, j, val)
+			}
+		}
+		grid = dilated
+	}
+
+	return grid
+}
+
+// erodeGrid is the dual of dilateGrid, the minimum of an image is the negated maximum of its
+// negation.
+func erodeGrid(grid *Grid, element *StructuringElement) *Grid {
+	negated := NewGrid(grid.Width, grid.Height)
+	for idx, val := range grid.Values {
+		negated.Values[idx] = -val
+	}
+
+	eroded := dilateGrid(negated, element)
+	for idx, val := range eroded.Values {
+		eroded.Values[idx] = -val
+	}
+
+	return eroded
+}
+
+// dilateMask sets the pixels within the element of a set pixel. Squares are dilated along rows then
+// columns by tracking the distance to the closest set pixel, which takes linear time in the radius.
+func dilateMask(mask *Mask, element *StructuringElement) *Mask {
+	if element.Shape == ElementSquare {
+		rows := dilateMaskLines(mask.Values, mask.Width, mask.Height, mask.Width, 1, element.Radius)
+		cols := dilateMaskLines(rows, mask.Height, mask.Width, 1, mask.Width, element.Radius)
+		return &Mask{Width: mask.Width, Height: mask.Height, Values: cols}
+	}
+
+	dilated := NewMask(mask.Width, mask.Height)
+	for i := 0; i < mask.Height; i++ {
+		for j := 0; j < mask.Width; j++ {
+			for _, offset := range element.Offsets {
+				y, x := i+offset[0], j+offset[1]
+				if 0 <= y && y < mask.Height && 0 <= x && x < mask.Width && mask.At(y, x) {
+					dilated.Set(i, j, true)
+					break
+				}
+			}
+		}
+	}
+
+	return dilated
+}
+
+// dilateMaskLines dilates count lines of the given length by radius, the lines start every stride
+// and their pixels are step apart.
+func dilateMaskLines(src []bool, length, count, stride, step, radius int) []bool {
+	dst := make([]bool, len(src))
+	for line := 0; line < count; line++ {
+		start := line * stride
+		last := -radius - 1
+		for k := 0; k < length; k++ {
+			if src[start+k*step] {
+				last = k
+			}
+			dst[start+k*step] = k-last <= radius
+		}
+
+		last = length + radius
+		for k := length - 1; k >= 0; k-- {
+			if src[start+k*step] {
+				last = k
+			}
+			dst[start+k*step] = dst[start+k*step] || last-k <= radius
+		}
+	}
+
+	return dst
+}
+
+// erodeMask is the dual of dilateMask, a pixel is kept unless its element reaches an unset pixel.
+func erodeMask(mask *Mask, element *StructuringElement) *Mask {
+	complement := NewMask(mask.Width, mask.Height)
+	for idx, set := range mask.Values {
+		complement.Values[idx] = !set
+	}
+
+	eroded := dilateMask(complement, element)
+	for idx, set := range eroded.Values {
+		eroded.Values[idx] = !set
+	}
+
+	return eroded
+}
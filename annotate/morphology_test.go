@@ -0,0 +1,218 @@
+package annotate
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewStructuringElement(t *testing.T) {
+	elements := []struct {
+		shape  string
+		radius int
+		size   int
+	}{
+		{ElementSquare, 0, 1},
+		{ElementSquare, 1, 9},
+		{ElementCross, 2, 9},
+		{ElementDisk, 2, 13},
+	}
+
+	for _, e := range elements {
+		element, err := NewStructuringElement(e.shape, e.radius)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(element.Offsets) != e.size {
+			t.Errorf("expected %s of radius %d to cover %d pixels, got %d", e.shape, e.radius, e.size,
+				len(element.Offsets))
+		}
+	}
+
+	var paramErr ParameterError
+	if _, err := NewStructuringElement("diamond", 1); !errors.As(err, &paramErr) || paramErr.Name != "shape" {
+		t.Errorf("expected shape parameter error, got %v", err)
+	}
+
+	if _, err := NewStructuringElement(ElementDisk, -1); !errors.As(err, &paramErr) || paramErr.Name != "radius" {
+		t.Errorf("expected radius parameter error, got %v", err)
+	}
+}
+
+func TestMorphology(t *testing.T) {
+	// A bright speck in the top-left corner and a bright wall with a one pixel gap in column 5.
+	grid, err := NewGridFromMat([][]float64{
+		{9, 0, 0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0, 9, 0},
+		{0, 0, 0, 0, 0, 9, 0},
+		{0, 0, 0, 0, 0, 0, 0},
+		{0, 0, 0, 0, 0, 9, 0},
+		{0, 0, 0, 0, 0, 9, 0},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cross, err := NewStructuringElement(ElementCross, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dilated, err := Dilate(grid, cross)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dilated.At(0, 1) != 9 || dilated.At(1, 0) != 9 || dilated.At(1, 1) != 0 {
+		t.Errorf("expected the speck to grow into a cross, got %v", dilated.Mat())
+	}
+
+	eroded, err := Erode(dilated, cross)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if eroded.At(0, 0) != 9 || eroded.At(0, 1) != 0 {
+		t.Errorf("expected erosion to shrink the cross back to the speck, got %v", eroded.Mat())
+	}
+
+	opened, err := Morph(grid, MorphOpen, cross)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, val := range opened.Values {
+		if val != 0 {
+			t.Errorf("expected opening to remove the speck and the thin wall at (%d, %d), got %f",
+				idx/opened.Width, idx%opened.Width, val)
+		}
+	}
+
+	// A cross only grows the wall into the gap and not beside it, so closing the gap takes a square.
+	square, err := NewStructuringElement(ElementSquare, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed, err := Morph(grid, MorphClose, square)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if closed.At(6, 5) != 9 || closed.At(6, 4) != 0 || closed.At(0, 0) != 9 {
+		t.Errorf("expected closing to fill the gap in the wall only, got %v", closed.Mat())
+	}
+
+	if _, err := Morph(grid, "gradient", cross); err == nil {
+		t.Error("expected unknown operation to fail")
+	}
+
+	if _, err := Dilate(grid, nil); err == nil {
+		t.Error("expected nil element to fail")
+	}
+}
+
+func TestMorphologySquare(t *testing.T) {
+	grid := randomGrid(20, 30)
+	square, err := NewStructuringElement(ElementSquare, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same offsets without the square shape skip the decomposition into lines.
+	generic := &StructuringElement{Radius: square.Radius, Offsets: square.Offsets}
+	for _, op := range []string{MorphDilate, MorphErode, MorphOpen, MorphClose} {
+		expected, err := Morph(grid, op, generic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actual, err := Morph(grid, op, square)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for idx := range actual.Values {
+			if actual.Values[idx] != expected.Values[idx] {
+				t.Fatalf("expected %s by lines to match the square at (%d, %d)", op, idx/grid.Width,
+					idx%grid.Width)
+			}
+		}
+
+		mask := NewMask(grid.Width, grid.Height)
+		for idx, val := range grid.Values {
+			mask.Values[idx] = val > 0.7
+		}
+
+		maskOps := map[string]func(*Mask, *StructuringElement) (*Mask, error){
+			MorphDilate: DilateMask, MorphErode: ErodeMask, MorphOpen: OpenMask, MorphClose: CloseMask,
+		}
+
+		expectedMask, err := maskOps[op](mask, generic)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		actualMask, err := maskOps[op](mask, square)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for idx := range actualMask.Values {
+			if actualMask.Values[idx] != expectedMask.Values[idx] {
+				t.Fatalf("expected binary %s by lines to match the square at (%d, %d)", op, idx/grid.Width,
+					idx%grid.Width)
+			}
+		}
+	}
+}
+
+func TestMorphologyMask(t *testing.T) {
+	mask := NewMask(7, 7)
+	for i := 1; i < 6; i++ {
+		for j := 1; j < 6; j++ {
+			mask.Set(i, j, i != 3 || j != 3)
+		}
+	}
+
+	disk, err := NewStructuringElement(ElementDisk, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	closed, err := CloseMask(mask, disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !closed.At(3, 3) || closed.At(0, 0) {
+		t.Errorf("expected closing to fill the hole only, got %v", closed.Values)
+	}
+
+	eroded, err := ErodeMask(mask, disk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if eroded.At(1, 1) || !eroded.At(2, 2) || eroded.At(2, 3) {
+		t.Errorf("expected erosion to peel the square and widen the hole, got %v", eroded.Values)
+	}
+
+	// Pixels outside of the image count as set, so a full mask is not eroded from its border.
+	full := NewMask(3, 3)
+	for idx := range full.Values {
+		full.Values[idx] = true
+	}
+
+	if eroded, err := ErodeMask(full, disk); err != nil || !eroded.At(0, 0) {
+		t.Errorf("expected a full mask to be kept, got %v, %v", eroded, err)
+	}
+
+	var imageErr ImageError
+	if _, err := DilateMask(&Mask{}, disk); !errors.As(err, &imageErr) {
+		t.Errorf("expected empty mask to fail with an image error, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package annotate
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+)
+
+func init() {
+	image.RegisterFormat("pgm", "P5", DecodePGM, DecodePGMConfig)
+	image.RegisterFormat("pgm", "P2", DecodePGM, DecodePGMConfig)
+}
+
+type pgmHeader struct {
+	Magic  string
+	Width  int
+	Height int
+	MaxVal int
+}
+
+// DecodePGM decodes a binary (P5) or plain (P2) portable gray map. Pixels with a maximum value
+// greater than 255 are scaled down to 8-bit.
+func DecodePGM(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	header, err := readPGMHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	img := image.NewGray(image.Rect(0, 0, header.Width, header.Height))
+	for i := 0; i < header.Width*header.Height; i++ {
+		var val int
+		if header.Magic == "P2" {
+			token, err := readPGMToken(br)
+			if err != nil {
+				return nil, fmt.Errorf("pgm: failed to read pixel %d: %w", i, err)
+			}
+
+			if val, err = strconv.Atoi(token); err != nil {
+				return nil, newImageError("pgm: invalid pixel value %q", token)
+			}
+		} else if header.MaxVal < 256 {
+			b, err := br.ReadByte()
+			if err != nil {
+				return nil, fmt.Errorf("pgm: failed to read pixel %d: %w", i, err)
+			}
+
+			val = int(b)
+		} else {
+			var buf [2]byte
+			if _, err := io.ReadFull(br, buf[:]); err != nil {
+				return nil, fmt.Errorf("pgm: failed to read pixel %d: %w", i, err)
+			}
+
+			val = int(buf[0])<<8 | int(buf[1])
+		}
+
+		if val < 0 || val > header.MaxVal {
+			return nil, newImageError("pgm: pixel value %d exceeds maximum value %d", val, header.MaxVal)
+		}
+
+		img.Pix[i] = uint8(val * 255 / header.MaxVal)
+	}
+
+	return img, nil
+}
+
+// DecodePGMConfig returns the color model and dimensions of a portable gray map without decoding
+// the entire image.
+func DecodePGMConfig(r io.Reader) (image.Config, error) {
+	header, err := readPGMHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	return image.Config{
+		ColorModel: color.GrayModel,
+		Width:      header.Width,
+		Height:     header.Height,
+	}, nil
+}
+
+func readPGMHeader(br *bufio.Reader) (*pgmHeader, error) {
+	magic, err := readPGMToken(br)
+	if err != nil {
+		return nil, fmt.Errorf("pgm: failed to read magic number: %w", err)
+	}
+
+	if magic != "P5" && magic != "P2" {
+		return nil, newImageError("pgm: unsupported magic number %q", magic)
+	}
+
+	header := &pgmHeader{Magic: magic}
+	for _, field := range []*int{&header.Width, &header.Height, &header.MaxVal} {
+		token, err := readPGMToken(br)
+		if err != nil {
+			return nil, fmt.Errorf("pgm: failed to read header: %w", err)
+		}
+
+		if *field, err = strconv.Atoi(token); err != nil || *field <= 0 {
+			return nil, newImageError("pgm: invalid header value %q", token)
+		}
+	}
+
+	if header.MaxVal > 65535 {
+		return nil, newImageError("pgm: maximum value %d is out of range", header.MaxVal)
+	}
+
+	return header, nil
+}
+
+// readPGMToken reads the next whitespace delimited token and skips comments. For the header, the
+// single whitespace character that terminates the token is consumed as the format requires before
+// binary raster data.
+func readPGMToken(br *bufio.Reader) (string, error) {
+	token := []byte{}
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF && len(token) > 0 {
+			return string(token), nil
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case b == '#' && len(token) == 0:
+			if _, err := br.ReadString('\n'); err != nil {
+				return "", err
+			}
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f':
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		default:
+			token = append(token, b)
+		}
+	}
+}
@@ -0,0 +1,489 @@
+package annotate
+
+import (
+	"fmt"
+	"image"
+)
+
+// Stage identifies a step of the auto keepout pipeline. Stages are ordered, running the pipeline
+// until a stage implies running every stage before it.
+type Stage int
+
+// Pipeline stages in the order they are executed.
+const (
+	StageFloodFill Stage = iota
+	StageMorphology
+	StageGaussianBlur
+	StageEdgeDetection
+	StageClustering
+	StageConvexHull
+)
+
+// PipelineOptions holds the parameters of every stage of the pipeline.
+type PipelineOptions struct {
+	// FloodFillNeighborDist is the dilation distance used when flood filling the exterior wall.
+	FloodFillNeighborDist int `json:"flood_fill_neighbor_dist"`
+	// FloodFillMatchMode selects which pixels flood fill grows through, MatchRelative or MatchAbsolute
+	// within FloodFillTolerance of the seed intensity, or MatchRange between FloodFillMinVal and
+	// FloodFillMaxVal.
+	FloodFillMatchMode string `json:"flood_fill_match_mode"`
+	// FloodFillTolerance is the tolerance on pixel intensity used when flood filling, a fraction of
+	// the seed intensity in relative mode and an intensity difference in absolute mode.
+	FloodFillTolerance float64 `json:"flood_fill_tolerance"`
+	FloodFillMinVal    float64 `json:"flood_fill_min_val"`
+	FloodFillMaxVal    float64 `json:"flood_fill_max_val"`
+	// FloodFillSeedMode selects where flood fill starts, SeedTopLeftCorner, SeedBorder from the border
+	// pixels that match FloodFillExteriorVal, or SeedCoordinates from FloodFillSeeds.
+	FloodFillSeedMode    string        `json:"flood_fill_seed_mode"`
+	FloodFillExteriorVal float64       `json:"flood_fill_exterior_val"`
+	FloodFillSeeds       []*Coordinate `json:"flood_fill_seeds"`
+	// FloodFillScanline uses the bounded memory scanline fill, see ScanlineFloodFill. It only dilates
+	// the region by FloodFillNeighborDist instead of letting it jump over narrower gaps.
+	FloodFillScanline bool `json:"flood_fill_scanline"`
+	// Morphology lists morphological operations applied in order after flood fill, MorphDilate,
+	// MorphErode, MorphOpen or MorphClose. They act on obstacles, the dark pixels, so closing bridges
+	// gaps in walls and opening removes speckle. MorphologyElement and MorphologyRadius give the
+	// structuring element, see NewStructuringElement.
+	Morphology        []string `json:"morphology"`
+	MorphologyElement string   `json:"morphology_element"`
+	MorphologyRadius  int      `json:"morphology_radius"`
+	// GaussianKernelSize and GaussianSigma configure the Gaussian blur kernel, see NewGaussianKernel.
+	// A sigma of zero uses the fixed GaussKernel table instead.
+	GaussianKernelSize int     `json:"gaussian_kernel_size"`
+	GaussianSigma      float64 `json:"gaussian_sigma"`
+	// SeparableConvolution uses one dimensional horizontal and vertical passes for Gaussian blur and
+	// Sobel operators, which is faster for large kernels. It requires a non-zero GaussianSigma.
+	SeparableConvolution bool `json:"separable_convolution"`
+	// Border determines how convolution kernels treat pixels outside of the image, empty means BorderZero.
+	Border BorderMode `json:"border"`
+	// NumRoutines is the number of go routines used for Gaussian blur and gradient computation.
+	NumRoutines int `json:"num_routines"`
+	// EdgeThresholdMode selects how local maxima are thresholded, one of ThresholdSingle,
+	// ThresholdHysteresis, ThresholdAutoMedian or ThresholdAutoOtsu.
+	EdgeThresholdMode string `json:"edge_threshold_mode"`
+	// EdgeThreshold is the minimum gradient magnitude for a local maximum to be considered an edge
+	// in single threshold mode.
+	EdgeThreshold float64 `json:"edge_threshold"`
+	// EdgeLowThreshold and EdgeHighThreshold are the weak and strong edge thresholds in hysteresis
+	// mode.
+	EdgeLowThreshold  float64 `json:"edge_low_threshold"`
+	EdgeHighThreshold float64 `json:"edge_high_threshold"`
+	// EdgeAutoSigma is the spread around the median magnitude in ThresholdAutoMedian mode.
+	EdgeAutoSigma float64 `json:"edge_auto_sigma"`
+	// ClusterMode selects the clustering algorithm, ClusterNearestNeighbor or ClusterDBSCAN.
+	ClusterMode string `json:"cluster_mode"`
+	// ClusterNeighborRange is the maximum pixel distance between two edge pixels of a cluster in
+	// nearest neighbor mode.
+	ClusterNeighborRange int `json:"cluster_neighbor_range"`
+	// ClusterEps and ClusterMinPoints are the neighborhood radius in pixels and the minimum number
+	// of edges in it for an edge to be a core edge in DBSCAN mode.
+	ClusterEps       float64 `json:"cluster_eps"`
+	ClusterMinPoints int     `json:"cluster_min_points"`
+	// ClusterFilter drops or merges clusters by size after clustering, its zero value keeps every
+	// cluster.
+	ClusterFilter ClusterFilter `json:"cluster_filter"`
+	// HullMode selects the keepout polygon of a cluster, HullConvex, HullConcave or HullRectangle.
+	HullMode string `json:"hull_mode"`
+	// HullConcavity and HullLengthThreshold control how deep concave hulls follow clusters, see
+	// ConcaveHull.
+	HullConcavity       float64 `json:"hull_concavity"`
+	HullLengthThreshold float64 `json:"hull_length_threshold"`
+	// InflationDistance offsets keepout polygons outward so they encode the clearance of the robot,
+	// zero leaves them hugging the edges. It is measured in pixels, or in metres when
+	// InflationCoordinates is MapCoordinates.
+	InflationDistance    float64 `json:"inflation_distance"`
+	InflationCoordinates string  `json:"inflation_coordinates"`
+	// InflationJoin shapes the corners of inflated polygons, JoinMiter or JoinRound.
+	InflationJoin string `json:"inflation_join"`
+	// MergePolygons merges keepout polygons that overlap or lie within MergeGap of each other after
+	// inflation, see UnionPolygons. MergeGap is measured in pixels, or in metres when
+	// MergeCoordinates is MapCoordinates.
+	MergePolygons    bool    `json:"merge_polygons"`
+	MergeGap         float64 `json:"merge_gap"`
+	MergeCoordinates string  `json:"merge_coordinates"`
+	// SimplifyTolerance and SimplifyMaxVertices simplify keepout polygons last, see SimplifyPolygon.
+	// The tolerance is measured in pixels, and zero for both keeps every vertex.
+	SimplifyTolerance   float64 `json:"simplify_tolerance"`
+	SimplifyMaxVertices int     `json:"simplify_max_vertices"`
+}
+
+// DefaultPipelineOptions returns the parameters that have been tuned on the sample maps.
+func DefaultPipelineOptions() PipelineOptions {
+	return PipelineOptions{
+		FloodFillNeighborDist: 5,
+		FloodFillMatchMode:    MatchRelative,
+		FloodFillTolerance:    0.10,
+		FloodFillSeedMode:     SeedTopLeftCorner,
+		FloodFillExteriorVal:  UnknownVal,
+		MorphologyElement:     ElementSquare,
+		MorphologyRadius:      1,
+		GaussianKernelSize:    KernelSize,
+		GaussianSigma:         0,
+		Border:                BorderZero,
+		NumRoutines:           4,
+		EdgeThresholdMode:     ThresholdSingle,
+		EdgeThreshold:         255,
+		EdgeLowThreshold:      100,
+		EdgeHighThreshold:     255,
+		EdgeAutoSigma:         0.33,
+		ClusterMode:           ClusterNearestNeighbor,
+		ClusterNeighborRange:  10,
+		ClusterEps:            5,
+		ClusterMinPoints:      8,
+		ClusterFilter:         ClusterFilter{Coordinates: PixelCoordinates},
+		HullMode:              HullConvex,
+		HullConcavity:         2,
+		HullLengthThreshold:   10,
+		InflationCoordinates:  PixelCoordinates,
+		InflationJoin:         JoinRound,
+		MergeCoordinates:      PixelCoordinates,
+	}
+}
+
+// PipelineResult holds the output of every stage that has been executed. Grids are indexed by row
+// and column starting from zero regardless of the bounds of the input image. Frame is only set when
+// the pipeline runs on a map, it converts pixel coordinates into the map frame.
+type PipelineResult struct {
+	Options     PipelineOptions
+	Bounds      image.Rectangle
+	Frame       *MapFrame
+	Intensity   *Grid
+	WallRemoved *Grid
+	// Morphed is WallRemoved after the morphological operations, the same grid when there is none.
+	Morphed   *Grid
+	Blurred   *Grid
+	Gradients *GradientField
+	// EdgeLowThreshold and EdgeHighThreshold are the thresholds that were applied to gradients. They
+	// are equal in single threshold mode.
+	EdgeLowThreshold  float64
+	EdgeHighThreshold float64
+	Clusters          map[int][]*Point
+	ClusterStats      *ClusterStatsReport
+	Polygons          map[int]*Polygon
+}
+
+// Pipeline runs the auto keepout algorithm on an image without touching the file system.
+type Pipeline struct {
+	Options PipelineOptions
+}
+
+// NewPipeline returns a pipeline configured with the given options.
+func NewPipeline(opts PipelineOptions) *Pipeline {
+	return &Pipeline{Options: opts}
+}
+
+// Run executes every stage of the pipeline on an image.
+func (p *Pipeline) Run(img image.Image) (*PipelineResult, error) {
+	return p.RunUntil(img, StageConvexHull)
+}
+
+// RunMap executes every stage of the pipeline on a map and carries its map frame into the result.
+func (p *Pipeline) RunMap(m *Map) (*PipelineResult, error) {
+	return p.RunMapUntil(m, StageConvexHull)
+}
+
+// RunMapUntil executes the pipeline on a map and stops after the given stage is completed. The map
+// frame lets cluster filter limits, the inflation distance and the merge gap be given in metres.
+func (p *Pipeline) RunMapUntil(m *Map, last Stage) (*PipelineResult, error) {
+	return p.run(m.Image, m.Frame, last)
+}
+
+// RunUntil executes the pipeline on an image and stops after the given stage is completed. Errors
+// are wrapped with the name of the failing stage, the underlying error can be retrieved with
+// errors.As.
+func (p *Pipeline) RunUntil(img image.Image, last Stage) (*PipelineResult, error) {
+	return p.run(img, nil, last)
+}
+
+// run executes the pipeline on an image, the frame is nil unless the image is a map.
+func (p *Pipeline) run(img image.Image, frame *MapFrame, last Stage) (*PipelineResult, error) {
+	if img.Bounds().Empty() {
+		return nil, newImageError("image %v has no pixel", img.Bounds())
+	}
+
+	res := &PipelineResult{
+		Options:   p.Options,
+		Bounds:    img.Bounds(),
+		Frame:     frame,
+		Intensity: GrayScaleGrid(img),
+	}
+
+	var err error
+	res.WallRemoved, err = p.floodFill(res.Intensity)
+	if err != nil {
+		return nil, fmt.Errorf("flood fill: %w", err)
+	}
+
+	if last == StageFloodFill {
+		return res, nil
+	}
+
+	res.Morphed, err = p.morphology(res.WallRemoved)
+	if err != nil {
+		return nil, fmt.Errorf("morphology: %w", err)
+	}
+
+	if last == StageMorphology {
+		return res, nil
+	}
+
+	res.Blurred, err = p.blur(res.Morphed)
+	if err != nil {
+		return nil, fmt.Errorf("blur: %w", err)
+	}
+
+	if last == StageGaussianBlur {
+		return res, nil
+	}
+
+	res.Gradients, err = p.gradient(res.Blurred)
+	if err != nil {
+		return nil, fmt.Errorf("edge detection: %w", err)
+	}
+
+	if err := p.thresholdEdges(res); err != nil {
+		return nil, fmt.Errorf("edge detection: %w", err)
+	}
+
+	if last == StageEdgeDetection {
+		return res, nil
+	}
+
+	if err := p.cluster(res.Gradients); err != nil {
+		return nil, fmt.Errorf("clustering: %w", err)
+	}
+
+	if err := FilterClusters(res.Gradients, p.Options.ClusterFilter, res.Frame); err != nil {
+		return nil, fmt.Errorf("clustering: %w", err)
+	}
+
+	res.Clusters = GroupClusters(res.Gradients)
+	if res.ClusterStats, err = NewClusterStatsReport(res.Gradients); err != nil {
+		return nil, fmt.Errorf("clustering: %w", err)
+	}
+
+	if last == StageClustering {
+		return res, nil
+	}
+
+	switch p.Options.HullMode {
+	case HullConvex:
+		res.Polygons = ConvexHullPolygons(res.Clusters)
+	case HullConcave:
+		if p.Options.HullConcavity < 1 {
+			return nil, fmt.Errorf("hull: %w", newParameterError("HullConcavity", p.Options.HullConcavity,
+				"must be at least 1"))
+		}
+
+		res.Polygons = ConcaveHullPolygons(res.Clusters, p.Options.HullConcavity, p.Options.HullLengthThreshold)
+	case HullRectangle:
+		res.Polygons = MinAreaRectanglePolygons(res.Clusters)
+	default:
+		return nil, fmt.Errorf("hull: %w", newParameterError("HullMode", p.Options.HullMode,
+			"must be convex, concave or rectangle"))
+	}
+
+	if res.Polygons, err = p.inflate(res.Polygons, res.Frame); err != nil {
+		return nil, fmt.Errorf("hull: %w", err)
+	}
+
+	if p.Options.MergePolygons {
+		gap, err := pixelDistance(p.Options.MergeGap, "MergeCoordinates", p.Options.MergeCoordinates, res.Frame)
+		if err != nil {
+			return nil, fmt.Errorf("hull: %w", err)
+		}
+
+		if res.Polygons, err = UnionPolygons(res.Polygons, gap); err != nil {
+			return nil, fmt.Errorf("hull: %w", err)
+		}
+	}
+
+	if p.Options.SimplifyTolerance != 0 || p.Options.SimplifyMaxVertices != 0 {
+		res.Polygons, err = SimplifyPolygons(res.Polygons, res.Clusters, p.Options.SimplifyTolerance,
+			p.Options.SimplifyMaxVertices)
+		if err != nil {
+			return nil, fmt.Errorf("hull: %w", err)
+		}
+	}
+
+	return res, nil
+}
+
+// inflate offsets keepout polygons by the configured distance, the frame is only required for a
+// distance in metres.
+func (p *Pipeline) inflate(polygons map[int]*Polygon, frame *MapFrame) (map[int]*Polygon, error) {
+	distance, err := pixelDistance(p.Options.InflationDistance, "InflationCoordinates", p.Options.InflationCoordinates,
+		frame)
+	if err != nil {
+		return nil, err
+	}
+
+	return InflatePolygons(polygons, distance, p.Options.InflationJoin)
+}
+
+// pixelDistance converts a distance option into pixels. The unit is given by the coordinates option
+// of that name, PixelCoordinates or MapCoordinates, and the frame is only required for metres.
+func pixelDistance(distance float64, name, coordinates string, frame *MapFrame) (float64, error) {
+	switch coordinates {
+	case "", PixelCoordinates:
+		return distance, nil
+	case MapCoordinates:
+		if frame == nil {
+			return 0, newParameterError(name, coordinates, "requires a map with a known resolution")
+		}
+
+		return distance / frame.Resolution, nil
+	default:
+		return 0, newParameterError(name, coordinates, "must be pixel or map")
+	}
+}
+
+// floodFill removes the exterior of an image with flood fill from the configured seeds.
+func (p *Pipeline) floodFill(grid *Grid) (*Grid, error) {
+	var match FloodFillPredicate
+	switch p.Options.FloodFillMatchMode {
+	case MatchRelative, MatchAbsolute:
+		if p.Options.FloodFillTolerance < 0 {
+			return nil, newParameterError("FloodFillTolerance", p.Options.FloodFillTolerance, "must not be negative")
+		}
+
+		match = RelativeTolerance(p.Options.FloodFillTolerance)
+		if p.Options.FloodFillMatchMode == MatchAbsolute {
+			match = AbsoluteTolerance(p.Options.FloodFillTolerance)
+		}
+	case MatchRange:
+		if p.Options.FloodFillMaxVal < p.Options.FloodFillMinVal {
+			return nil, newParameterError("FloodFillMaxVal", p.Options.FloodFillMaxVal,
+				"must not be less than FloodFillMinVal")
+		}
+
+		match = ValueRange(p.Options.FloodFillMinVal, p.Options.FloodFillMaxVal)
+	default:
+		return nil, newParameterError("FloodFillMatchMode", p.Options.FloodFillMatchMode,
+			"must be relative, absolute or range")
+	}
+
+	fromSeeds, fromBorder := FloodFillFromSeeds, FloodFillFromBorder
+	if p.Options.FloodFillScanline {
+		fromSeeds, fromBorder = ScanlineFloodFill, ScanlineFloodFillFromBorder
+	}
+
+	switch p.Options.FloodFillSeedMode {
+	case SeedTopLeftCorner:
+		return fromSeeds(grid, []*Coordinate{{0, 0}}, p.Options.FloodFillNeighborDist, match)
+	case SeedBorder:
+		return fromBorder(grid, p.Options.FloodFillExteriorVal, p.Options.FloodFillNeighborDist, match)
+	case SeedCoordinates:
+		return fromSeeds(grid, p.Options.FloodFillSeeds, p.Options.FloodFillNeighborDist, match)
+	default:
+		return nil, newParameterError("FloodFillSeedMode", p.Options.FloodFillSeedMode,
+			"must be top-left, border or coordinates")
+	}
+}
+
+// morphology applies the configured morphological operations to the obstacles of an image. Obstacles
+// are dark, so every operation on them is its dual on intensities.
+func (p *Pipeline) morphology(grid *Grid) (*Grid, error) {
+	if len(p.Options.Morphology) == 0 {
+		return grid, nil
+	}
+
+	element, err := NewStructuringElement(p.Options.MorphologyElement, p.Options.MorphologyRadius)
+	if err != nil {
+		return nil, err
+	}
+
+	duals := map[string]string{MorphDilate: MorphErode, MorphErode: MorphDilate, MorphOpen: MorphClose,
+		MorphClose: MorphOpen}
+	for _, operation := range p.Options.Morphology {
+		dual, ok := duals[operation]
+		if !ok {
+			return nil, newParameterError("Morphology", operation, "must be dilate, erode, open or close")
+		}
+
+		if grid, err = Morph(grid, dual, element); err != nil {
+			return nil, err
+		}
+	}
+
+	return grid, nil
+}
+
+// blur applies the configured Gaussian blur to an image matrix.
+func (p *Pipeline) blur(grid *Grid) (*Grid, error) {
+	if p.Options.SeparableConvolution {
+		if p.Options.GaussianSigma == 0 {
+			return nil, newParameterError("GaussianSigma", p.Options.GaussianSigma,
+				"must be positive for separable convolution")
+		}
+
+		kernel, err := NewGaussianKernel1D(p.Options.GaussianKernelSize, p.Options.GaussianSigma)
+		if err != nil {
+			return nil, err
+		}
+
+		return ParallelSeparableGaussianMask(grid, kernel, p.Options.NumRoutines, p.Options.Border)
+	}
+
+	kernel := GaussKernel
+	if p.Options.GaussianSigma != 0 {
+		var err error
+		if kernel, err = NewGaussianKernel(p.Options.GaussianKernelSize, p.Options.GaussianSigma); err != nil {
+			return nil, err
+		}
+	}
+
+	return ParallelGaussianMaskWithKernel(grid, kernel, p.Options.NumRoutines, p.Options.Border)
+}
+
+// gradient computes the gradients of an image matrix with the configured convolution.
+func (p *Pipeline) gradient(grid *Grid) (*GradientField, error) {
+	if p.Options.SeparableConvolution {
+		return ParallelSeparableGradientMask(grid, p.Options.NumRoutines, p.Options.Border)
+	}
+
+	return ParallelGradientMask(grid, p.Options.NumRoutines, p.Options.Border)
+}
+
+// cluster labels the edges of a gradient field with the configured clustering algorithm.
+func (p *Pipeline) cluster(field *GradientField) error {
+	switch p.Options.ClusterMode {
+	case ClusterNearestNeighbor:
+		return SimpleNearestNeighborClustering(field, p.Options.ClusterNeighborRange)
+	case ClusterDBSCAN:
+		return DBSCANClustering(field, p.Options.ClusterEps, p.Options.ClusterMinPoints)
+	default:
+		return newParameterError("ClusterMode", p.Options.ClusterMode, "must be nearest-neighbor or dbscan")
+	}
+}
+
+// thresholdEdges applies non-maximum suppression and the configured thresholding to gradients, and
+// records the applied thresholds in the result.
+func (p *Pipeline) thresholdEdges(res *PipelineResult) error {
+	var err error
+	low, high := p.Options.EdgeLowThreshold, p.Options.EdgeHighThreshold
+	switch p.Options.EdgeThresholdMode {
+	case ThresholdSingle:
+		res.EdgeLowThreshold, res.EdgeHighThreshold = p.Options.EdgeThreshold, p.Options.EdgeThreshold
+		return NonMaximumSuppression(res.Gradients, p.Options.EdgeThreshold)
+	case ThresholdHysteresis:
+	case ThresholdAutoMedian:
+		low, high, err = MedianThresholds(res.Gradients, p.Options.EdgeAutoSigma)
+	case ThresholdAutoOtsu:
+		low, high, err = OtsuThresholds(res.Gradients)
+	default:
+		return newParameterError("EdgeThresholdMode", p.Options.EdgeThresholdMode,
+			"must be single, hysteresis, auto-median or auto-otsu")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	res.EdgeLowThreshold, res.EdgeHighThreshold = low, high
+	if err := NonMaximumSuppression(res.Gradients, low); err != nil {
+		return err
+	}
+
+	return HysteresisThreshold(res.Gradients, low, high)
+}
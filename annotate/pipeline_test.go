@@ -0,0 +1,217 @@
+package annotate
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+)
+
+// squareImage returns an occupancy grid style image. The exterior is unknown gray, the building is
+// enclosed by a black wall, and a black square obstacle sits in the middle of the white interior.
+func squareImage(size, squareSize int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	wallStart, wallEnd := size/10, size-size/10
+	start := (size - squareSize) / 2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			switch {
+			case y < wallStart || y >= wallEnd || x < wallStart || x >= wallEnd:
+				img.Set(x, y, color.Gray{205})
+			case y < wallStart+3 || y >= wallEnd-3 || x < wallStart+3 || x >= wallEnd-3:
+				img.Set(x, y, color.Gray{0})
+			case start <= y && y < start+squareSize && start <= x && x < start+squareSize:
+				img.Set(x, y, color.Gray{0})
+			default:
+				img.Set(x, y, color.Gray{255})
+			}
+		}
+	}
+
+	return img
+}
+
+func TestPipeline(t *testing.T) {
+	img := squareImage(100, 30)
+
+	t.Run("RunUntilStopsAtStage", func(t *testing.T) {
+		res, err := NewPipeline(DefaultPipelineOptions()).RunUntil(img, StageGaussianBlur)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.Blurred == nil {
+			t.Error("expected blurred matrix to be populated")
+		}
+
+		if res.Gradients != nil || res.Clusters != nil || res.Polygons != nil {
+			t.Error("expected stages after Gaussian blur to be skipped")
+		}
+	})
+
+	t.Run("RunFindsObstacle", func(t *testing.T) {
+		res, err := NewPipeline(DefaultPipelineOptions()).Run(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Clusters) == 0 {
+			t.Fatal("expected obstacle to produce at least one cluster")
+		}
+
+		for id, points := range res.Clusters {
+			for _, p := range points {
+				if p.Y < 30 || p.Y >= 70 || p.X < 30 || p.X >= 70 {
+					t.Errorf("cluster %d has point %v outside of the obstacle", id, p)
+				}
+			}
+
+			if len(res.Polygons[id].Vertices) == 0 {
+				t.Errorf("expected cluster %d to have polygon vertices", id)
+			}
+		}
+	})
+	t.Run("RunWithHysteresis", func(t *testing.T) {
+		opts := DefaultPipelineOptions()
+		opts.EdgeThresholdMode = ThresholdHysteresis
+		res, err := NewPipeline(opts).Run(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Clusters) == 0 {
+			t.Error("expected obstacle to produce at least one cluster")
+		}
+	})
+
+	t.Run("RunWithAutoThresholdsOnBlankImage", func(t *testing.T) {
+		for _, size := range []int{1, 20} {
+			blank := image.NewGray(image.Rect(0, 0, size, size))
+			for _, mode := range []string{ThresholdAutoMedian, ThresholdAutoOtsu} {
+				opts := DefaultPipelineOptions()
+				opts.EdgeThresholdMode = mode
+				res, err := NewPipeline(opts).Run(blank)
+				if err != nil {
+					t.Fatalf("expected %s on a blank %dx%d image to succeed, got %v", mode, size, size, err)
+				}
+
+				if len(res.Clusters) != 0 {
+					t.Errorf("expected %s on a blank %dx%d image to find no cluster, got %d", mode, size, size,
+						len(res.Clusters))
+				}
+			}
+		}
+	})
+
+	t.Run("RunWithSeparableConvolution", func(t *testing.T) {
+		opts := DefaultPipelineOptions()
+		opts.SeparableConvolution = true
+		if _, err := NewPipeline(opts).Run(img); err == nil {
+			t.Error("expected separable convolution without sigma to fail")
+		}
+
+		opts.GaussianSigma = 1.4
+		res, err := NewPipeline(opts).Run(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Clusters) == 0 {
+			t.Error("expected obstacle to produce at least one cluster")
+		}
+	})
+
+	t.Run("RunWithDBSCAN", func(t *testing.T) {
+		opts := DefaultPipelineOptions()
+		opts.ClusterMode = ClusterDBSCAN
+		res, err := NewPipeline(opts).Run(img)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(res.Polygons) == 0 {
+			t.Error("expected obstacle to produce at least one polygon")
+		}
+
+		if _, ok := res.Polygons[NoiseClusterID]; ok {
+			t.Error("expected noise to be excluded from polygons")
+		}
+
+		opts.ClusterMode = "k-means"
+		if _, err := NewPipeline(opts).Run(img); err == nil {
+			t.Error("expected unknown cluster mode to fail")
+		}
+	})
+
+	t.Run("RunWithFloodFillModes", func(t *testing.T) {
+		opts := DefaultPipelineOptions()
+		opts.FloodFillSeedMode = SeedBorder
+		opts.FloodFillMatchMode = MatchRange
+		opts.FloodFillMinVal, opts.FloodFillMaxVal = 200, 210
+		res, err := NewPipeline(opts).RunUntil(img, StageFloodFill)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.WallRemoved.At(0, 0) != FloodFillVal || res.WallRemoved.At(50, 50) != 0 {
+			t.Error("expected the exterior to be removed and the obstacle to be kept")
+		}
+
+		opts.FloodFillMaxVal = 100
+		var paramErr ParameterError
+		if _, err := NewPipeline(opts).Run(img); !errors.As(err, &paramErr) || paramErr.Name != "FloodFillMaxVal" {
+			t.Errorf("expected FloodFillMaxVal parameter error, got %v", err)
+		}
+	})
+
+	t.Run("RunWithMorphology", func(t *testing.T) {
+		// A one pixel gap splits the obstacle in two.
+		split := squareImage(100, 30)
+		for y := 35; y < 65; y++ {
+			split.Set(50, y, color.Gray{255})
+		}
+
+		opts := DefaultPipelineOptions()
+		opts.Morphology = []string{MorphClose}
+		res, err := NewPipeline(opts).RunUntil(split, StageMorphology)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.WallRemoved.At(50, 50) < 250 || res.Morphed.At(50, 50) != 0 || res.Morphed.At(20, 20) < 250 {
+			t.Errorf("expected closing to bridge the gap in the obstacle only, got %f", res.Morphed.At(50, 50))
+		}
+
+		if res.Blurred != nil {
+			t.Error("expected stages after morphology to be skipped")
+		}
+
+		opts.Morphology = []string{"thin"}
+		var paramErr ParameterError
+		if _, err := NewPipeline(opts).Run(img); !errors.As(err, &paramErr) || paramErr.Name != "Morphology" {
+			t.Errorf("expected Morphology parameter error, got %v", err)
+		}
+	})
+
+	t.Run("RunReturnsTypedErrors", func(t *testing.T) {
+		opts := DefaultPipelineOptions()
+		opts.NumRoutines = 0
+		_, err := NewPipeline(opts).Run(img)
+
+		var paramErr ParameterError
+		if !errors.As(err, &paramErr) || paramErr.Name != "numRoutines" {
+			t.Errorf("expected numRoutines parameter error, got %v", err)
+		}
+
+		var mathErr MathError
+		if !errors.As(err, &mathErr) {
+			t.Errorf("expected parameter error to unwrap to MathError, got %v", err)
+		}
+
+		_, err = NewPipeline(DefaultPipelineOptions()).Run(image.NewGray(image.Rect(0, 0, 0, 0)))
+		var imageErr ImageError
+		if !errors.As(err, &imageErr) {
+			t.Errorf("expected image error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package annotate
+
+import (
+	"math"
+	"sort"
+)
+
+// Polygon is a closed keepout polygon of a cluster. The last vertex connects back to the first
+// vertex, the first vertex is not repeated. Vertices are ordered counter-clockwise in (X, Y)
+// coordinates, which appears clockwise on screen because image rows grow downward.
+type Polygon struct {
+	ClusterID int
+	NumPoints int
+	Vertices  []*Point
+	// MergedClusterIDs lists in ascending order the clusters whose polygons were merged into this
+	// one, including ClusterID. It is nil for a polygon of a single cluster.
+	MergedClusterIDs []int
+}
+
+// Area returns the area enclosed by the polygon in square pixels.
+func (p *Polygon) Area() float64 {
+	return math.Abs(signedArea(p.Vertices))
+}
+
+// Perimeter returns the length of the closed boundary of the polygon in pixels.
+func (p *Polygon) Perimeter() float64 {
+	var perimeter float64
+	for i := 0; i < len(p.Vertices); i++ {
+		a, b := p.Vertices[i], p.Vertices[(i+1)%len(p.Vertices)]
+		perimeter += math.Hypot(float64(b.X-a.X), float64(b.Y-a.Y))
+	}
+
+	return perimeter
+}
+
+// insidePolygon indicates whether a point lies inside or on the boundary of a closed polygon.
+func insidePolygon(vertices []*Point, point *Point) bool {
+	inside := false
+	for i, j := 0, len(vertices)-1; i < len(vertices); j, i = i, i+1 {
+		a, b := vertices[j], vertices[i]
+		if crossProduct(a, b, point) == 0 && onSegment(a, b, point) {
+			return true
+		}
+
+		if (a.Y > point.Y) != (b.Y > point.Y) && (b.Y > a.Y) == (crossProduct(a, b, point) > 0) {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+// ConvexHullPolygons computes a convex keepout polygon for every cluster.
+func ConvexHullPolygons(clusters map[int][]*Point) map[int]*Polygon {
+	polygons := make(map[int]*Polygon, len(clusters))
+	for id, points := range clusters {
+		polygons[id] = &Polygon{
+			ClusterID: id,
+			NumPoints: len(points),
+			Vertices:  MonotoneChainHull(points),
+		}
+	}
+
+	return polygons
+}
+
+// MonotoneChainHull returns the convex hull vertices of a set of points using Andrew's monotone
+// chain algorithm. Collinear points on the hull boundary are dropped and the vertices are ordered
+// counter-clockwise in (X, Y) coordinates. The input slice is left untouched.
+func MonotoneChainHull(points []*Point) []*Point {
+	sorted := make([]*Point, len(points))
+	copy(sorted, points)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].X != sorted[j].X {
+			return sorted[i].X < sorted[j].X
+		}
+
+		return sorted[i].Y < sorted[j].Y
+	})
+
+	// Remove duplicated coordinates so that degenerate clusters do not yield repeated vertices.
+	unique := sorted[:0:0]
+	for _, point := range sorted {
+		if len(unique) > 0 && unique[len(unique)-1].X == point.X && unique[len(unique)-1].Y == point.Y {
+			continue
+		}
+
+		unique = append(unique, point)
+	}
+
+	if len(unique) < 3 {
+		return unique
+	}
+
+	hull := make([]*Point, 0, 2*len(unique))
+
+	// Lower chain
+	for _, point := range unique {
+		for len(hull) >= 2 && crossProduct(hull[len(hull)-2], hull[len(hull)-1], point) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, point)
+	}
+
+	// Upper chain
+	lowerSize := len(hull) + 1
+	for i := len(unique) - 2; i >= 0; i-- {
+		for len(hull) >= lowerSize && crossProduct(hull[len(hull)-2], hull[len(hull)-1], unique[i]) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, unique[i])
+	}
+
+	// The last point is the same as the first point.
+	return hull[:len(hull)-1]
+}
+
+// signedArea uses the shoelace formula to compute the signed area of a closed polygon. The area is
+// positive when vertices are ordered counter-clockwise in (X, Y) coordinates.
+func signedArea(vertices []*Point) float64 {
+	var sum int
+	for i := 0; i < len(vertices); i++ {
+		a, b := vertices[i], vertices[(i+1)%len(vertices)]
+		sum += a.X*b.Y - b.X*a.Y
+	}
+
+	return float64(sum) / 2
+}
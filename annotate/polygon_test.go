@@ -0,0 +1,61 @@
+package annotate
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMonotoneChainHull(t *testing.T) {
+	t.Run("SquareWithInteriorAndCollinearPoints", func(t *testing.T) {
+		points := []*Point{}
+		for i := 0; i <= 4; i++ {
+			for j := 0; j <= 4; j++ {
+				points = append(points, &Point{false, i, j})
+			}
+		}
+
+		hull := MonotoneChainHull(points)
+		if len(hull) != 4 {
+			t.Fatalf("expected 4 hull vertices, got %v", hull)
+		}
+
+		polygon := &Polygon{Vertices: hull}
+		if signedArea(hull) <= 0 {
+			t.Errorf("expected counter-clockwise winding, got signed area %f", signedArea(hull))
+		}
+
+		if polygon.Area() != 16 {
+			t.Errorf("expected area 16, got %f", polygon.Area())
+		}
+
+		if polygon.Perimeter() != 16 {
+			t.Errorf("expected perimeter 16, got %f", polygon.Perimeter())
+		}
+	})
+
+	t.Run("Triangle", func(t *testing.T) {
+		hull := MonotoneChainHull([]*Point{{false, 0, 0}, {false, 0, 3}, {false, 4, 0}, {false, 1, 1}})
+		polygon := &Polygon{Vertices: hull}
+		if len(hull) != 3 {
+			t.Fatalf("expected 3 hull vertices, got %v", hull)
+		}
+
+		if polygon.Area() != 6 {
+			t.Errorf("expected area 6, got %f", polygon.Area())
+		}
+
+		if math.Abs(polygon.Perimeter()-12) > 1e-9 {
+			t.Errorf("expected perimeter 12, got %f", polygon.Perimeter())
+		}
+	})
+
+	t.Run("Degenerate", func(t *testing.T) {
+		if hull := MonotoneChainHull([]*Point{{false, 1, 1}, {false, 1, 1}}); len(hull) != 1 {
+			t.Errorf("expected duplicated points to collapse into 1 vertex, got %v", hull)
+		}
+
+		if hull := MonotoneChainHull([]*Point{{false, 0, 0}, {false, 1, 1}, {false, 2, 2}}); len(hull) != 2 {
+			t.Errorf("expected collinear points to yield 2 vertices, got %v", hull)
+		}
+	})
+}
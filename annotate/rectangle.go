@@ -0,0 +1,136 @@
+package annotate
+
+import "math"
+
+// MinAreaRectanglePolygons computes an oriented rectangle keepout for every cluster, see
+// MinAreaRectangle.
+func MinAreaRectanglePolygons(clusters map[int][]*Point) map[int]*Polygon {
+	polygons := make(map[int]*Polygon, len(clusters))
+	for id, points := range clusters {
+		polygons[id] = &Polygon{
+			ClusterID: id,
+			NumPoints: len(points),
+			Vertices:  MinAreaRectangle(points),
+		}
+	}
+
+	return polygons
+}
+
+// MinAreaRectangle returns the four corners of the smallest rectangle at any angle that encloses a
+// set of points, ordered counter-clockwise in (X, Y) coordinates. Rotating calipers around the convex
+// hull find the rectangle with a side on every hull edge. Points that are collinear, such as a wall
+// one pixel thick, yield a thin rectangle reaching half a pixel to both sides of the line. Corners are
+// rounded away from the center of the rectangle, and grown by under a pixel on every side in the rare
+// case that rounding cuts a point off a turned rectangle. Since rounding can cost a thin turned
+// rectangle more than it saves, the candidates are compared after rounding, and the bounding box
+// along the axes is kept unless a turned rectangle is smaller.
+func MinAreaRectangle(points []*Point) []*Point {
+	hull := MonotoneChainHull(points)
+	if len(hull) == 0 {
+		return hull
+	}
+
+	n := len(hull)
+	pos := func(i int) (float64, float64) {
+		return float64(hull[i%n].X), float64(hull[i%n].Y)
+	}
+
+	if n < 3 {
+		originX, originY := pos(0)
+		bx, by := pos(n - 1)
+		length := math.Hypot(bx-originX, by-originY)
+		frame := rectangleFrame{originX: originX, originY: originY, ux: 1, maxDot: length, low: -0.5, high: 0.5}
+		if length > 0 {
+			frame.ux, frame.uy = (bx-originX)/length, (by-originY)/length
+		} else {
+			frame.minDot, frame.maxDot = -0.5, 0.5
+		}
+
+		return frame.corners(points)
+	}
+
+	bounds := vertexBounds(hull)
+	best := rectangleFrame{ux: 1, minDot: float64(bounds[0]), maxDot: float64(bounds[2]), low: float64(bounds[1]),
+		high: float64(bounds[3])}.corners(points)
+	bestArea := (&Polygon{Vertices: best}).Area()
+
+	right, top, left := 1, 1, 1
+	for i := 0; i < n; i++ {
+		ax, ay := pos(i)
+		bx, by := pos(i + 1)
+		length := math.Hypot(bx-ax, by-ay)
+		ex, ey := (bx-ax)/length, (by-ay)/length
+
+		// Distances along the edge and toward the inside of the counter-clockwise hull.
+		along := func(k int) float64 {
+			x, y := pos(k)
+			return (x-ax)*ex + (y-ay)*ey
+		}
+		across := func(k int) float64 {
+			x, y := pos(k)
+			return (y-ay)*ex - (x-ax)*ey
+		}
+
+		// The calipers only move forward as the edge turns around the hull.
+		right = max(right, i+1)
+		for along(right+1) > along(right)+1e-9 {
+			right++
+		}
+
+		top = max(top, right)
+		for across(top+1) > across(top)+1e-9 {
+			top++
+		}
+
+		left = max(left, top)
+		for along(left+1) < along(left)-1e-9 {
+			left++
+		}
+
+		rectangle := rectangleFrame{originX: ax, originY: ay, ux: ex, uy: ey, minDot: along(left),
+			maxDot: along(right), high: across(top)}.corners(points)
+		if area := (&Polygon{Vertices: rectangle}).Area(); area < bestArea {
+			best, bestArea = rectangle, area
+		}
+	}
+
+	return best
+}
+
+// rectangleFrame is a rectangle that spans [minDot, maxDot] along the unit vector (ux, uy) from an
+// origin, and [low, high] to its left.
+type rectangleFrame struct {
+	originX, originY float64
+	ux, uy           float64
+	minDot, maxDot   float64
+	low, high        float64
+}
+
+// corners rounds the corners of the frame to pixels so that the rectangle still holds the points.
+func (f rectangleFrame) corners(points []*Point) []*Point {
+	round := func(pad float64, round func(val, center float64) int) []*Point {
+		frame := [][2]float64{{f.minDot - pad, f.low - pad}, {f.maxDot + pad, f.low - pad},
+			{f.maxDot + pad, f.high + pad}, {f.minDot - pad, f.high + pad}}
+		centerDot, centerSide := (f.minDot+f.maxDot)/2, (f.low+f.high)/2
+		cx := f.originX + centerDot*f.ux - centerSide*f.uy
+		cy := f.originY + centerDot*f.uy + centerSide*f.ux
+
+		rectangle := make([]*Point, len(frame))
+		for k, corner := range frame {
+			x := f.originX + corner[0]*f.ux - corner[1]*f.uy
+			y := f.originY + corner[0]*f.uy + corner[1]*f.ux
+			rectangle[k] = &Point{Y: round(y, cy), X: round(x, cx)}
+		}
+
+		return rectangle
+	}
+
+	rectangle := round(0, roundAway)
+	if coversPoints(rectangle, points) {
+		return rectangle
+	}
+
+	// Rounding moves a corner by at most half a pixel along each axis.
+	return round(math.Sqrt(0.5), func(val, _ float64) int { return int(math.Round(val)) })
+}
@@ -0,0 +1,210 @@
+package annotate
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// rotatedRectangle returns points along the outline of a rectangle centered on (100, 100) and turned
+// by an angle in radians.
+func rotatedRectangle(length, width, angle float64) []*Point {
+	sin, cos := math.Sincos(angle)
+	var points []*Point
+	for _, side := range [][4]float64{{-1, -1, 1, -1}, {1, -1, 1, 1}, {1, 1, -1, 1}, {-1, 1, -1, -1}} {
+		for s := 0.0; s <= 1; s += 0.01 {
+			u := (side[0] + s*(side[2]-side[0])) * length / 2
+			v := (side[1] + s*(side[3]-side[1])) * width / 2
+			x, y := 100+u*cos-v*sin, 100+u*sin+v*cos
+			points = append(points, &Point{false, int(math.Round(y)), int(math.Round(x))})
+		}
+	}
+
+	return points
+}
+
+func TestMinAreaRectangle(t *testing.T) {
+	for _, angle := range []float64{0, 0.3, math.Pi / 4, 2} {
+		points := rotatedRectangle(80, 20, angle)
+		rectangle := MinAreaRectangle(points)
+		polygon := &Polygon{Vertices: rectangle}
+		if len(rectangle) != 4 || signedArea(rectangle) <= 0 {
+			t.Fatalf("expected four counter-clockwise corners at angle %f, got %v", angle, rectangle)
+		}
+
+		for _, point := range points {
+			if !insidePolygon(rectangle, point) {
+				t.Fatalf("expected %v to be inside the rectangle %v at angle %f", point, rectangle, angle)
+			}
+		}
+
+		// Rounding the outline and the corners costs about a pixel and a half on every side.
+		if area := polygon.Area(); area < 80*20*0.9 || area > 83*23 {
+			t.Errorf("expected area close to %d at angle %f, got %f", 80*20, angle, area)
+		}
+
+		bounds := vertexBounds(points)
+		boxArea := float64((bounds[2] - bounds[0]) * (bounds[3] - bounds[1]))
+		if angle == 0.3 && polygon.Area() >= boxArea {
+			t.Errorf("expected the turned rectangle to be smaller than the bounding box %f, got %f", boxArea,
+				polygon.Area())
+		}
+	}
+
+	// Two rows of pixels need no rounding, so the rectangle is exact.
+	var rows []*Point
+	for x := 0; x < 10; x++ {
+		rows = append(rows, &Point{false, 5, x}, &Point{false, 6, x})
+	}
+
+	expected := []*Point{{false, 5, 0}, {false, 5, 9}, {false, 6, 9}, {false, 6, 0}}
+	if rectangle := MinAreaRectangle(rows); !sameVertices(rectangle, expected) {
+		t.Errorf("expected the rows to yield %v, got %v", expected, rectangle)
+	}
+}
+
+func TestMinAreaRectangleRounding(t *testing.T) {
+	// Rounding the corners of these thin turned rectangles costs more than the turn saves.
+	hulls := [][]*Point{
+		{{false, 0, 9}, {false, 3, 10}, {false, 19, 11}},
+		{{false, 7, 1}, {false, 6, 10}, {false, 8, 1}},
+	}
+
+	for _, points := range hulls {
+		rectangle := MinAreaRectangle(points)
+		bounds := vertexBounds(points)
+		boxArea := float64((bounds[2] - bounds[0]) * (bounds[3] - bounds[1]))
+		if area := (&Polygon{Vertices: rectangle}).Area(); area > boxArea {
+			t.Errorf("expected at most the bounding box area %f for %v, got %f with %v", boxArea, points, area,
+				rectangle)
+		}
+	}
+
+	// Compare with rectangles on every hull edge that project every point, rounded the same way.
+	rng := rand.New(rand.NewSource(1))
+	for trial := 0; trial < 500; trial++ {
+		length, width := 2+rng.Float64()*30, rng.Float64()*6
+		sin, cos := math.Sincos(rng.Float64() * math.Pi)
+		points := make([]*Point, 3+rng.Intn(20))
+		for k := range points {
+			u, v := (rng.Float64()-0.5)*length, (rng.Float64()-0.5)*width
+			points[k] = &Point{false, int(math.Round(50 + u*sin + v*cos)), int(math.Round(50 + u*cos - v*sin))}
+		}
+
+		hull := MonotoneChainHull(points)
+		if len(hull) < 3 {
+			continue
+		}
+
+		bounds := vertexBounds(points)
+		expected := float64((bounds[2] - bounds[0]) * (bounds[3] - bounds[1]))
+		for i, a := range hull {
+			b := hull[(i+1)%len(hull)]
+			edge := math.Hypot(float64(b.X-a.X), float64(b.Y-a.Y))
+			frame := rectangleFrame{originX: float64(a.X), originY: float64(a.Y), ux: float64(b.X-a.X) / edge,
+				uy: float64(b.Y-a.Y) / edge, minDot: math.Inf(1), maxDot: math.Inf(-1), low: math.Inf(1),
+				high: math.Inf(-1)}
+			for _, point := range points {
+				x, y := float64(point.X)-frame.originX, float64(point.Y)-frame.originY
+				dot, side := x*frame.ux+y*frame.uy, y*frame.ux-x*frame.uy
+				frame.minDot, frame.maxDot = math.Min(frame.minDot, dot), math.Max(frame.maxDot, dot)
+				frame.low, frame.high = math.Min(frame.low, side), math.Max(frame.high, side)
+			}
+
+			expected = math.Min(expected, (&Polygon{Vertices: frame.corners(points)}).Area())
+		}
+
+		rectangle := MinAreaRectangle(points)
+		area := (&Polygon{Vertices: rectangle}).Area()
+		if len(rectangle) != 4 || !coversPoints(rectangle, points) || signedArea(rectangle) <= 0 {
+			t.Fatalf("expected four counter-clockwise corners holding %v, got %v", points, rectangle)
+		}
+
+		if math.Abs(area-expected) > 1e-9 {
+			t.Fatalf("expected area %f for %v, got %f with %v", expected, points, area, rectangle)
+		}
+	}
+}
+
+// sameVertices indicates whether two polygons have the same vertices up to the starting vertex.
+func sameVertices(a, b []*Point) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for shift := range a {
+		same := true
+		for k := range a {
+			same = same && *a[(k+shift)%len(a)] == *b[k]
+		}
+
+		if same {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestMinAreaRectangleLines(t *testing.T) {
+	lines := map[string][]*Point{
+		"Horizontal": nil,
+		"Vertical":   nil,
+		"Diagonal":   nil,
+		"Single":     {{false, 3, 3}},
+	}
+	for k := 0; k < 10; k++ {
+		lines["Horizontal"] = append(lines["Horizontal"], &Point{false, 5, k})
+		lines["Vertical"] = append(lines["Vertical"], &Point{false, k, 5})
+		lines["Diagonal"] = append(lines["Diagonal"], &Point{false, k, k})
+	}
+
+	for name, points := range lines {
+		t.Run(name, func(t *testing.T) {
+			rectangle := MinAreaRectangle(points)
+			if len(rectangle) != 4 || signedArea(rectangle) <= 0 {
+				t.Fatalf("expected a thin counter-clockwise rectangle, got %v", rectangle)
+			}
+
+			for _, point := range points {
+				if !insidePolygon(rectangle, point) {
+					t.Errorf("expected %v to be inside the rectangle %v", point, rectangle)
+				}
+
+				if point.IsHullVertex {
+					t.Errorf("expected the cluster point %v to be left unlabeled", point)
+				}
+			}
+
+			if area := (&Polygon{Vertices: rectangle}).Area(); area > 4*float64(len(points)) {
+				t.Errorf("expected a thin rectangle, got area %f for %v", area, rectangle)
+			}
+		})
+	}
+
+	expected := []*Point{{false, 4, 0}, {false, 4, 9}, {false, 6, 9}, {false, 6, 0}}
+	if rectangle := MinAreaRectangle(lines["Horizontal"]); !sameVertices(rectangle, expected) {
+		t.Errorf("expected the horizontal wall to yield %v, got %v", expected, rectangle)
+	}
+}
+
+func TestPipelineRectangle(t *testing.T) {
+	opts := DefaultPipelineOptions()
+	opts.HullMode = HullRectangle
+	res, err := NewPipeline(opts).Run(squareImage(100, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, polygon := range res.Polygons {
+		if len(polygon.Vertices) != 4 {
+			t.Errorf("expected cluster %d to have a four-corner keepout, got %v", id, polygon.Vertices)
+		}
+
+		for _, point := range res.Clusters[id] {
+			if !insidePolygon(polygon.Vertices, point) {
+				t.Fatalf("expected %v to be inside the rectangle of cluster %d", point, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package annotate
+
+import "math"
+
+// Separable Sobel operators, Gx is the outer product of SobelSmooth as a column and SobelDerivative
+// as a row, and Gy is the outer product of the reversed SobelDerivative as a column and SobelSmooth
+// as a row.
+var (
+	SobelSmooth     = []float64{1.0, 2.0, 1.0}
+	SobelDerivative = []float64{-1.0, 0.0, 1.0}
+)
+
+// NewGaussianKernel1D builds a normalized one dimensional Gaussian kernel of any odd size. The outer
+// product of the kernel with itself is the kernel returned by NewGaussianKernel.
+func NewGaussianKernel1D(size int, sigma float64) ([]float64, error) {
+	if size < 1 || size%2 != 1 {
+		return nil, newKernelError("kernel size must be a positive odd integer, got %d", size)
+	}
+
+	if sigma <= 0 {
+		return nil, newParameterError("sigma", sigma, "must be positive")
+	}
+
+	offset := (size - 1) / 2
+	kernel := make([]float64, size)
+
+	var norm float64
+	for i := 0; i < size; i++ {
+		x := float64(i - offset)
+		kernel[i] = math.Exp(-(x * x) / (2 * sigma * sigma))
+		norm += kernel[i]
+	}
+
+	for i := 0; i < size; i++ {
+		kernel[i] /= norm
+	}
+
+	return kernel, nil
+}
+
+// SeparableGaussianMask applies Gaussian blur to an image grid with a horizontal pass followed by
+// a vertical pass of a one dimensional kernel. It costs 2k operations per pixel instead of k*k for a
+// k by k kernel.
+func SeparableGaussianMask(grid *Grid, kernel []float64, border BorderMode) (*Grid, error) {
+	return ParallelSeparableGaussianMask(grid, kernel, 1, border)
+}
+
+// ParallelSeparableGaussianMask is SeparableGaussianMask with each pass split across multiple go
+// routines.
+func ParallelSeparableGaussianMask(grid *Grid, kernel []float64, numRoutines int,
+	border BorderMode) (*Grid, error) {
+	if err := validateSeparable(grid, kernel, numRoutines); err != nil {
+		return nil, err
+	}
+
+	mode, err := resolveBorder(border)
+	if err != nil {
+		return nil, err
+	}
+
+	horizontal := parallelConvolve1D(grid, kernel, false, mode, numRoutines)
+	return parallelConvolve1D(horizontal, kernel, true, mode, numRoutines), nil
+}
+
+// SeparableGradientMask computes the same gradients as GradientMask using separable Sobel operators.
+func SeparableGradientMask(grid *Grid, border BorderMode) (*GradientField, error) {
+	return ParallelSeparableGradientMask(grid, 1, border)
+}
+
+// ParallelSeparableGradientMask is SeparableGradientMask with each pass split across multiple go
+// routines.
+func ParallelSeparableGradientMask(grid *Grid, numRoutines int, border BorderMode) (*GradientField, error) {
+	if err := validateSeparable(grid, SobelSmooth, numRoutines); err != nil {
+		return nil, err
+	}
+
+	mode, err := resolveBorder(border)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(SobelDerivative) != len(SobelSmooth) {
+		return nil, newKernelError("Sobel operators must have the same size")
+	}
+
+	reversedDerivative := make([]float64, len(SobelDerivative))
+	for i, val := range SobelDerivative {
+		reversedDerivative[len(SobelDerivative)-1-i] = val
+	}
+
+	gradX := parallelConvolve1D(parallelConvolve1D(grid, SobelDerivative, false, mode, numRoutines), SobelSmooth,
+		true, mode, numRoutines)
+	gradY := parallelConvolve1D(parallelConvolve1D(grid, SobelSmooth, false, mode, numRoutines), reversedDerivative,
+		true, mode, numRoutines)
+
+	field := NewGradientField(grid.Width, grid.Height)
+	for idx := range field.X {
+		field.setVector(idx, gradX.Values[idx], gradY.Values[idx])
+	}
+
+	return field, nil
+}
+
+func validateSeparable(grid *Grid, kernel []float64, numRoutines int) error {
+	if err := validateGrid(grid); err != nil {
+		return err
+	}
+
+	if len(kernel)%2 != 1 {
+		return newKernelError("kernel size must be an odd integer, got %d", len(kernel))
+	}
+
+	return validateNumRoutines(numRoutines)
+}
+
+// parallelConvolve1D convolves every row, or every column when vertical is set, of a grid with a
+// one dimensional kernel. Rows of the output are split evenly across go routines.
+func parallelConvolve1D(grid *Grid, kernel []float64, vertical bool, mode BorderMode, numRoutines int) *Grid {
+	output := NewGrid(grid.Width, grid.Height)
+	parallelRows(grid.Height, numRoutines, func(startRow, endRow int) {
+		for i := startRow; i < endRow; i++ {
+			for j := 0; j < grid.Width; j++ {
+				output.Values[i*grid.Width+j] = convolve1D(grid, i, j, kernel, vertical, mode)
+			}
+		}
+	})
+
+	return output
+}
+
+// convolve1D performs a one dimensional convolution at a given location of a grid along a row, or
+// along a column when vertical is set. Out of bound region is handled like convolve does.
+func convolve1D(grid *Grid, y, x int, kernel []float64, vertical bool, mode BorderMode) (sum float64) {
+	offset := (len(kernel) - 1) / 2
+	for k := 0; k < len(kernel); k++ {
+		i, j, ok := y, x, true
+		if vertical {
+			if i = y + k - offset; i < 0 || grid.Height <= i {
+				i, ok = borderIndex(i, grid.Height, mode)
+			}
+		} else {
+			if j = x + k - offset; j < 0 || grid.Width <= j {
+				j, ok = borderIndex(j, grid.Width, mode)
+			}
+		}
+
+		if !ok {
+			continue
+		}
+
+		sum += kernel[k] * grid.Values[i*grid.Width+j]
+	}
+
+	return sum
+}
@@ -0,0 +1,292 @@
+package annotate
+
+import (
+	"math"
+	"sort"
+)
+
+// SimplifyPolygons simplifies every keepout polygon so that it still holds the points of its source
+// clusters that it held before, see SimplifyPolygon.
+func SimplifyPolygons(polygons map[int]*Polygon, clusters map[int][]*Point, tolerance float64,
+	maxVertices int) (map[int]*Polygon, error) {
+	simplified := make(map[int]*Polygon, len(polygons))
+	for id, polygon := range polygons {
+		var points []*Point
+		for _, clusterID := range polygon.sourceClusterIDs() {
+			points = append(points, clusters[clusterID]...)
+		}
+
+		var err error
+		if simplified[id], err = SimplifyPolygon(polygon, points, tolerance, maxVertices); err != nil {
+			return nil, err
+		}
+	}
+
+	return simplified, nil
+}
+
+// SimplifyPolygon drops the vertices of a polygon that lie within tolerance pixels of the outline
+// with the Douglas-Peucker algorithm. Vertices are kept back as long as the outline crosses itself
+// or leaves out one of the points that the polygon holds, so the simplified polygon stays simple and
+// still holds every cluster point that the input polygon holds. Points outside of the input polygon
+// are not checked. A positive maxVertices caps the number of vertices. When the simplified polygon
+// exceeds it, the convex hull of the polygon is cut down to the cap by extending its edges, which
+// only grows the keepout, and the bounding box of the polygon is the last resort.
+func SimplifyPolygon(polygon *Polygon, points []*Point, tolerance float64, maxVertices int) (*Polygon, error) {
+	if tolerance < 0 {
+		return nil, newParameterError("tolerance", tolerance, "must not be negative")
+	}
+
+	if maxVertices < 0 || (maxVertices > 0 && maxVertices < 4) {
+		return nil, newParameterError("maxVertices", maxVertices, "must be zero or at least 4")
+	}
+
+	simplified := &Polygon{ClusterID: polygon.ClusterID, NumPoints: polygon.NumPoints,
+		MergedClusterIDs: polygon.MergedClusterIDs, Vertices: polygon.Vertices}
+	vertices := polygon.Vertices
+	if len(vertices) < 4 {
+		return simplified, nil
+	}
+
+	var inside []*Point
+	for _, point := range points {
+		if insidePolygon(vertices, point) {
+			inside = append(inside, point)
+		}
+	}
+
+	kept := douglasPeucker(vertices, tolerance)
+	for {
+		outline := make([]*Point, len(kept))
+		for k, idx := range kept {
+			outline[k] = vertices[idx]
+		}
+
+		chains := uncoveredChains(outline, inside)
+		if len(chains) == 0 {
+			simplified.Vertices = outline
+			break
+		}
+
+		// Chains index the outline before any vertex is given back.
+		n := len(kept)
+		giveBack := func(chains []int) {
+			for _, k := range chains {
+				if idx, _ := farthestVertex(vertices, kept[k], kept[(k+1)%n]); idx >= 0 {
+					kept = append(kept, idx)
+				}
+			}
+			kept = uniqueInts(kept)
+		}
+
+		// The edge closest to a point left out may have no vertex to give back while another edge cuts
+		// the point off, every edge gives a vertex back then.
+		if giveBack(chains); len(kept) == n {
+			all := make([]int, n)
+			for k := range all {
+				all[k] = k
+			}
+			giveBack(all)
+		}
+
+		// Every vertex is kept, the polygon itself does not hold the points.
+		if len(kept) == n {
+			simplified.Vertices = outline
+			break
+		}
+	}
+
+	if maxVertices == 0 || len(simplified.Vertices) <= maxVertices {
+		return simplified, nil
+	}
+
+	simplified.Vertices = reduceConvexPolygon(MonotoneChainHull(vertices), maxVertices)
+	if len(simplified.Vertices) > maxVertices || !coversPoints(simplified.Vertices, inside) {
+		bounds := vertexBounds(vertices)
+		simplified.Vertices = []*Point{{Y: bounds[1], X: bounds[0]}, {Y: bounds[1], X: bounds[2]},
+			{Y: bounds[3], X: bounds[2]}, {Y: bounds[3], X: bounds[0]}}
+	}
+
+	return simplified, nil
+}
+
+// douglasPeucker returns the ascending indices of the vertices of a closed polygon that Douglas-
+// Peucker keeps. The ring is split at the first vertex and the vertex farthest from it, then the
+// chain with the farthest vertex from its edge is split until every vertex is within tolerance.
+func douglasPeucker(vertices []*Point, tolerance float64) []int {
+	far, farDist := 0, 0
+	for i, vertex := range vertices {
+		if dist := squaredDistance(vertices[0], vertex); dist > farDist {
+			far, farDist = i, dist
+		}
+	}
+
+	kept := []int{0, far}
+	for {
+		split, splitDist := -1, tolerance
+		for k := range kept {
+			if idx, dist := farthestVertex(vertices, kept[k], kept[(k+1)%len(kept)]); idx >= 0 && dist > splitDist {
+				split, splitDist = idx, dist
+			}
+		}
+
+		if split < 0 {
+			return kept
+		}
+
+		kept = append(kept, split)
+		sort.Ints(kept)
+	}
+}
+
+// uniqueInts sorts integers in place and drops the duplicates.
+func uniqueInts(vals []int) []int {
+	sort.Ints(vals)
+	unique := vals[:0]
+	for _, val := range vals {
+		if len(unique) == 0 || val != unique[len(unique)-1] {
+			unique = append(unique, val)
+		}
+	}
+
+	return unique
+}
+
+// farthestVertex returns the vertex of a closed polygon strictly between two vertices, walking
+// forward and wrapping around, that is farthest from the edge joining them. The index is -1 when
+// the vertices are adjacent.
+func farthestVertex(vertices []*Point, from, to int) (int, float64) {
+	end := to
+	if end <= from {
+		end += len(vertices)
+	}
+
+	idx, dist := -1, -1.0
+	for i := from + 1; i < end; i++ {
+		if d := segmentDistance(vertices[i%len(vertices)], vertices[from], vertices[to]); d > dist {
+			idx, dist = i%len(vertices), d
+		}
+	}
+
+	return idx, dist
+}
+
+// uncoveredChains returns the edges of a simplified outline that have to give back vertices, the
+// edges that cross another edge and the edges closest to a point that the outline leaves out.
+func uncoveredChains(outline, points []*Point) []int {
+	edges := polygonEdges(outline)
+	marked := make(map[int]bool)
+	for i := range edges {
+		for j := i + 2; j < len(edges); j++ {
+			if i == 0 && j == len(edges)-1 {
+				continue
+			}
+
+			if segmentsIntersect(edges[i][0], edges[i][1], edges[j][0], edges[j][1]) {
+				marked[i], marked[j] = true, true
+			}
+		}
+	}
+
+	if len(marked) == 0 {
+		for _, point := range points {
+			if insidePolygon(outline, point) {
+				continue
+			}
+
+			closest, closestDist := 0, math.Inf(1)
+			for k, edge := range edges {
+				if dist := segmentDistance(point, edge[0], edge[1]); dist < closestDist {
+					closest, closestDist = k, dist
+				}
+			}
+			marked[closest] = true
+		}
+	}
+
+	chains := make([]int, 0, len(marked))
+	for k := range marked {
+		chains = append(chains, k)
+	}
+	sort.Ints(chains)
+
+	return chains
+}
+
+// reduceConvexPolygon cuts a counter-clockwise convex polygon down to a number of vertices. An edge
+// is removed by extending its neighbors until they meet, and the edge that adds the least area goes
+// first. New vertices are rounded away from the polygon.
+func reduceConvexPolygon(vertices []*Point, maxVertices int) []*Point {
+	type position struct{ x, y float64 }
+	ring := make([]position, len(vertices))
+	for i, vertex := range vertices {
+		ring[i] = position{float64(vertex.X), float64(vertex.Y)}
+	}
+
+	for len(ring) > maxVertices {
+		n := len(ring)
+		best, bestArea := -1, math.Inf(1)
+		var bestPos position
+		for i := range ring {
+			prev, a, b, next := ring[(i+n-1)%n], ring[i], ring[(i+1)%n], ring[(i+2)%n]
+			ux, uy := a.x-prev.x, a.y-prev.y
+			vx, vy := next.x-b.x, next.y-b.y
+
+			// The neighbors meet beyond the edge only when they turn by less than half a turn.
+			denom := ux*vy - uy*vx
+			if denom <= 1e-12 {
+				continue
+			}
+
+			t := ((b.x-a.x)*vy - (b.y-a.y)*vx) / denom
+			pos := position{a.x + t*ux, a.y + t*uy}
+			area := math.Abs((b.x-a.x)*(pos.y-a.y)-(b.y-a.y)*(pos.x-a.x)) / 2
+			if t >= 0 && area < bestArea {
+				best, bestArea, bestPos = i, area, pos
+			}
+		}
+
+		if best < 0 {
+			break
+		}
+
+		ring[best] = bestPos
+		ring = append(ring[:(best+1)%n], ring[(best+1)%n+1:]...)
+	}
+
+	var cx, cy float64
+	for _, pos := range ring {
+		cx, cy = cx+pos.x/float64(len(ring)), cy+pos.y/float64(len(ring))
+	}
+
+	reduced := make([]*Point, len(ring))
+	for i, pos := range ring {
+		reduced[i] = &Point{X: roundAway(pos.x, cx), Y: roundAway(pos.y, cy)}
+	}
+
+	return reduced
+}
+
+// roundAway rounds a coordinate to an integer away from a center.
+func roundAway(val, center float64) int {
+	if val < center {
+		return int(math.Floor(val + 1e-9))
+	}
+
+	return int(math.Ceil(val - 1e-9))
+}
+
+// coversPoints indicates whether a simple polygon holds every point.
+func coversPoints(vertices, points []*Point) bool {
+	if !isSimplePolygon(vertices) {
+		return false
+	}
+
+	for _, point := range points {
+		if !insidePolygon(vertices, point) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,203 @@
+package annotate
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// jaggedSquare returns a 40x40 square outline with a vertex every 2 pixels, every other vertex is
+// pushed in by a pixel. The vertices that stay on the square are returned as cluster points.
+func jaggedSquare() (*Polygon, []*Point) {
+	corners := [][2]int{{0, 0}, {0, 40}, {40, 40}, {40, 0}}
+	normals := [][2]int{{-1, 0}, {0, 1}, {1, 0}, {0, -1}}
+
+	polygon := &Polygon{ClusterID: 1}
+	var points []*Point
+	for i, corner := range corners {
+		next := corners[(i+1)%len(corners)]
+		for k := 0; k < 20; k++ {
+			y, x := corner[0]+k*(next[0]-corner[0])/20, corner[1]+k*(next[1]-corner[1])/20
+			if k%2 == 1 {
+				y, x = y-normals[i][0], x-normals[i][1]
+			} else {
+				points = append(points, &Point{false, y, x})
+			}
+			polygon.Vertices = append(polygon.Vertices, &Point{false, y, x})
+		}
+	}
+
+	return polygon, points
+}
+
+// randomStarPolygon returns a simple counter-clockwise polygon with vertices at increasing angles and
+// random distances around (50, 50).
+func randomStarPolygon(rng *rand.Rand, numVertices int) *Polygon {
+	polygon := &Polygon{ClusterID: 1}
+	for k := 0; k < numVertices; k++ {
+		angle := 2 * math.Pi * (float64(k) + 0.8*rng.Float64()) / float64(numVertices)
+		radius := 10 + 30*rng.Float64()
+		sin, cos := math.Sincos(angle)
+		vertex := &Point{false, 50 + int(math.Round(radius*sin)), 50 + int(math.Round(radius*cos))}
+		if last := len(polygon.Vertices) - 1; last >= 0 && *polygon.Vertices[last] == *vertex {
+			continue
+		}
+		polygon.Vertices = append(polygon.Vertices, vertex)
+	}
+
+	return polygon
+}
+
+func TestSimplifyPolygon(t *testing.T) {
+	t.Run("DropsJaggedVertices", func(t *testing.T) {
+		polygon, points := jaggedSquare()
+		if signedArea(polygon.Vertices) <= 0 || !isSimplePolygon(polygon.Vertices) {
+			t.Fatal("expected a simple counter-clockwise jagged square")
+		}
+
+		simplified, err := SimplifyPolygon(polygon, points, 2, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(simplified.Vertices) != 4 || simplified.Area() != 1600 {
+			t.Errorf("expected the jagged edges to be dropped, got %v", simplified.Vertices)
+		}
+
+		unchanged, err := SimplifyPolygon(polygon, points, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(unchanged.Vertices) != len(polygon.Vertices) {
+			t.Errorf("expected zero tolerance to keep %d vertices, got %d", len(polygon.Vertices),
+				len(unchanged.Vertices))
+		}
+	})
+
+	t.Run("KeepsPointsInside", func(t *testing.T) {
+		points := lShape()
+		polygon := &Polygon{Vertices: ConcaveHull(points, 1, 0)}
+		simplified, err := SimplifyPolygon(polygon, points, 100, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !coversPoints(simplified.Vertices, points) {
+			t.Errorf("expected %v to hold every point of the L", simplified.Vertices)
+		}
+	})
+
+	t.Run("VertexBudget", func(t *testing.T) {
+		disk, err := InflatePolygon(&Polygon{Vertices: []*Point{{false, 50, 50}}}, 20, JoinRound)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, budget := range []int{4, 6, 10} {
+			simplified, err := SimplifyPolygon(disk, disk.Vertices, 0, budget)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(simplified.Vertices) > budget || !coversPoints(simplified.Vertices, disk.Vertices) {
+				t.Errorf("expected at most %d vertices holding the disk, got %v", budget, simplified.Vertices)
+			}
+		}
+
+		points := lShape()
+		polygon := &Polygon{Vertices: ConcaveHull(points, 1, 0)}
+		simplified, err := SimplifyPolygon(polygon, points, 0, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(simplified.Vertices) > 4 || !coversPoints(simplified.Vertices, points) {
+			t.Errorf("expected at most 4 vertices holding the L, got %v", simplified.Vertices)
+		}
+	})
+
+	t.Run("GivesBackVerticesOnce", func(t *testing.T) {
+		// Giving back a vertex on the last edge of the outline used to read the index just given back
+		// instead of the first one, which kept duplicating vertices.
+		polygon := &Polygon{ClusterID: 1}
+		for _, xy := range [][2]int{{1, 8}, {3, 5}, {4, 3}, {4, 0}, {9, 0}, {11, 1}, {10, 6}, {6, 9}, {2, 9}} {
+			polygon.Vertices = append(polygon.Vertices, &Point{false, xy[1], xy[0]})
+		}
+
+		simplified, err := SimplifyPolygon(polygon, polygon.Vertices, 3, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(simplified.Vertices) > len(polygon.Vertices) || !isSimplePolygon(simplified.Vertices) {
+			t.Errorf("expected a simple polygon of at most %d vertices, got %v", len(polygon.Vertices),
+				simplified.Vertices)
+		}
+	})
+
+	t.Run("CoversRandomPolygons", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(1))
+		for trial := 0; trial < 200; trial++ {
+			polygon := randomStarPolygon(rng, 5+rng.Intn(30))
+			if !isSimplePolygon(polygon.Vertices) {
+				continue
+			}
+
+			var inside []*Point
+			for _, vertex := range polygon.Vertices {
+				if insidePolygon(polygon.Vertices, vertex) {
+					inside = append(inside, vertex)
+				}
+			}
+
+			tolerance := 10 * rng.Float64()
+			simplified, err := SimplifyPolygon(polygon, polygon.Vertices, tolerance, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(simplified.Vertices) > len(polygon.Vertices) || !coversPoints(simplified.Vertices, inside) {
+				t.Fatalf("expected %v simplified with tolerance %f to hold its vertices, got %v",
+					polygon.Vertices, tolerance, simplified.Vertices)
+			}
+		}
+	})
+
+	t.Run("InvalidParameters", func(t *testing.T) {
+		var paramErr ParameterError
+		if _, err := SimplifyPolygon(squarePolygon(1, 0, 0, 10), nil, -1, 0); !errors.As(err, &paramErr) ||
+			paramErr.Name != "tolerance" {
+			t.Errorf("expected tolerance parameter error, got %v", err)
+		}
+
+		if _, err := SimplifyPolygon(squarePolygon(1, 0, 0, 10), nil, 1, 3); !errors.As(err, &paramErr) ||
+			paramErr.Name != "maxVertices" {
+			t.Errorf("expected maxVertices parameter error, got %v", err)
+		}
+	})
+}
+
+func TestPipelineSimplify(t *testing.T) {
+	opts := DefaultPipelineOptions()
+	opts.HullMode = HullConcave
+	opts.SimplifyTolerance = 3
+	opts.SimplifyMaxVertices = 6
+	res, err := NewPipeline(opts).Run(squareImage(100, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, polygon := range res.Polygons {
+		if len(polygon.Vertices) > 6 {
+			t.Errorf("expected polygon of cluster %d to have at most 6 vertices, got %d", id, len(polygon.Vertices))
+		}
+
+		for _, point := range res.Clusters[id] {
+			if !insidePolygon(polygon.Vertices, point) {
+				t.Fatalf("expected %v to be inside the simplified polygon of cluster %d", point, id)
+			}
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package annotate
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ClusterStats summarizes the edges of a cluster for review. Coordinates, lengths and areas are
+// measured in pixels.
+type ClusterStats struct {
+	ClusterID  int `json:"cluster_id"`
+	PixelCount int `json:"pixel_count"`
+	// MinX, MinY, MaxX and MaxY bound the edges of the cluster inclusively.
+	MinX      int     `json:"min_x"`
+	MinY      int     `json:"min_y"`
+	MaxX      int     `json:"max_x"`
+	MaxY      int     `json:"max_y"`
+	CentroidX float64 `json:"centroid_x"`
+	CentroidY float64 `json:"centroid_y"`
+	HullArea  float64 `json:"hull_area"`
+	// MeanMagnitude is the mean gradient magnitude of the edges of the cluster.
+	MeanMagnitude float64 `json:"mean_magnitude"`
+	// DirectionHistogram counts the edges of the cluster by gradient direction, and DominantDirection
+	// is the most frequent direction. Edges without direction are not counted.
+	DirectionHistogram map[string]int `json:"direction_histogram"`
+	DominantDirection  string         `json:"dominant_direction"`
+}
+
+// ClusterStatsReport holds the statistics of every cluster ordered by cluster ID.
+type ClusterStatsReport struct {
+	Clusters []*ClusterStats `json:"clusters"`
+}
+
+// NewClusterStatsReport computes the statistics of every cluster of a labeled gradient field. Noise
+// edges are left out.
+func NewClusterStatsReport(field *GradientField) (*ClusterStatsReport, error) {
+	if err := validateGradientField(field); err != nil {
+		return nil, err
+	}
+
+	clusters := GroupClusters(field)
+	report := &ClusterStatsReport{Clusters: make([]*ClusterStats, 0, len(clusters))}
+	for id, points := range clusters {
+		shape := newClusterShape(points)
+		stats := &ClusterStats{
+			ClusterID:          id,
+			PixelCount:         len(points),
+			MinX:               shape.minX,
+			MinY:               shape.minY,
+			MaxX:               shape.maxX,
+			MaxY:               shape.maxY,
+			HullArea:           shape.area,
+			DirectionHistogram: make(map[string]int),
+		}
+
+		for _, point := range points {
+			idx := point.Y*field.Width + point.X
+			stats.CentroidX += float64(point.X)
+			stats.CentroidY += float64(point.Y)
+			stats.MeanMagnitude += field.magnitude(idx)
+			if field.Dir[idx] != codeNone {
+				stats.DirectionHistogram[Directions[field.Dir[idx]]]++
+			}
+		}
+
+		stats.CentroidX /= float64(len(points))
+		stats.CentroidY /= float64(len(points))
+		stats.MeanMagnitude /= float64(len(points))
+
+		// Ties go to the direction that comes first in Directions.
+		for _, dir := range Directions[1:] {
+			if stats.DirectionHistogram[dir] > stats.DirectionHistogram[stats.DominantDirection] {
+				stats.DominantDirection = dir
+			}
+		}
+
+		report.Clusters = append(report.Clusters, stats)
+	}
+
+	sort.Slice(report.Clusters, func(i, j int) bool {
+		return report.Clusters[i].ClusterID < report.Clusters[j].ClusterID
+	})
+
+	return report, nil
+}
+
+// EncodeJSON writes the report as indented JSON.
+func (r *ClusterStatsReport) EncodeJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// EncodeCSV writes the report as CSV with a header row and one row per cluster. The direction
+// histogram takes one column per direction.
+func (r *ClusterStatsReport) EncodeCSV(w io.Writer) error {
+	header := []string{"cluster_id", "pixel_count", "min_x", "min_y", "max_x", "max_y", "centroid_x", "centroid_y",
+		"hull_area", "mean_magnitude", "dominant_direction"}
+	for _, dir := range Directions[1:] {
+		header = append(header, strings.ToLower(dir))
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	formatFloat := func(val float64) string {
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	}
+
+	for _, stats := range r.Clusters {
+		row := []string{
+			strconv.Itoa(stats.ClusterID),
+			strconv.Itoa(stats.PixelCount),
+			strconv.Itoa(stats.MinX),
+			strconv.Itoa(stats.MinY),
+			strconv.Itoa(stats.MaxX),
+			strconv.Itoa(stats.MaxY),
+			formatFloat(stats.CentroidX),
+			formatFloat(stats.CentroidY),
+			formatFloat(stats.HullArea),
+			formatFloat(stats.MeanMagnitude),
+			stats.DominantDirection,
+		}
+
+		for _, dir := range Directions[1:] {
+			row = append(row, strconv.Itoa(stats.DirectionHistogram[dir]))
+		}
+
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,87 @@
+package annotate
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestClusterStatsReport(t *testing.T) {
+	field := NewGradientField(10, 10)
+	for _, p := range [][2]int{{1, 1}, {1, 3}, {3, 1}, {3, 3}} {
+		field.Set(p[0], p[1], Gradient{X: 3, Y: 4, IsLocalMax: true})
+	}
+	field.Set(2, 2, Gradient{X: -6, Y: 8, IsLocalMax: true})
+	field.Set(7, 7, Gradient{IsLocalMax: true})
+
+	if err := SimpleNearestNeighborClustering(field, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := NewClusterStatsReport(field)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Clusters) != 2 || report.Clusters[0].ClusterID != 1 || report.Clusters[1].ClusterID != 2 {
+		t.Fatalf("expected two clusters ordered by ID, got %v", report.Clusters)
+	}
+
+	stats := report.Clusters[0]
+	if stats.PixelCount != 5 || stats.MinX != 1 || stats.MinY != 1 || stats.MaxX != 3 || stats.MaxY != 3 {
+		t.Errorf("incorrect pixel count or bounding box %+v", stats)
+	}
+
+	if stats.CentroidX != 2 || stats.CentroidY != 2 || stats.HullArea != 4 {
+		t.Errorf("incorrect centroid or hull area %+v", stats)
+	}
+
+	if stats.MeanMagnitude != 6 {
+		t.Errorf("expected mean magnitude 6, got %f", stats.MeanMagnitude)
+	}
+
+	if stats.DirectionHistogram[NE] != 4 || stats.DirectionHistogram[NW] != 1 || stats.DominantDirection != NE {
+		t.Errorf("incorrect direction histogram %v dominated by %s", stats.DirectionHistogram, stats.DominantDirection)
+	}
+
+	if report.Clusters[1].DominantDirection != "" || len(report.Clusters[1].DirectionHistogram) != 0 {
+		t.Errorf("expected edge without direction to be left out of the histogram, got %+v", report.Clusters[1])
+	}
+
+	t.Run("EncodeCSV", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := report.EncodeCSV(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 3 {
+			t.Fatalf("expected header and two rows, got %q", buf.String())
+		}
+
+		if !strings.HasPrefix(lines[0], "cluster_id,pixel_count,") || !strings.HasSuffix(lines[0], ",south,south_east") {
+			t.Errorf("unexpected header %s", lines[0])
+		}
+
+		if expected := "1,5,1,1,3,3,2,2,4,6,NORTH_EAST,0,4,0,1,0,0,0,0"; lines[1] != expected {
+			t.Errorf("expected row %s, got %s", expected, lines[1])
+		}
+	})
+
+	t.Run("EncodeJSON", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := report.EncodeJSON(&buf); err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded ClusterStatsReport
+		if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(decoded.Clusters) != 2 || decoded.Clusters[0].DirectionHistogram[NE] != 4 {
+			t.Errorf("expected report to survive a round trip, got %s", buf.String())
+		}
+	})
+}
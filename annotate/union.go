@@ -0,0 +1,364 @@
+package annotate
+
+import (
+	"math"
+	"sort"
+)
+
+// UnionPolygons merges keepout polygons that overlap, touch or lie within gap pixels of each other
+// into single polygons. Polygons within the gap are joined by a bridge that spans their closest
+// edges. A merged polygon takes the smallest cluster ID of its sources, the sum of their point
+// counts, and lists every source in MergedClusterIDs. Holes enclosed by merged polygons are filled,
+// and when the outline of a group cannot be traced as a simple polygon, for instance because two
+// polygons only touch at a vertex, the group is replaced by its convex hull.
+func UnionPolygons(polygons map[int]*Polygon, gap float64) (map[int]*Polygon, error) {
+	if gap < 0 {
+		return nil, newParameterError("gap", gap, "must not be negative")
+	}
+
+	ids := make([]int, 0, len(polygons))
+	for id := range polygons {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	bounds := make([][4]int, len(ids))
+	for i, id := range ids {
+		bounds[i] = vertexBounds(polygons[id].Vertices)
+	}
+
+	uf := newUnionFind(len(ids))
+	bridges := make(map[int][][]*Point)
+	reach := int(math.Ceil(gap))
+	for i := range ids {
+		for j := i + 1; j < len(ids); j++ {
+			if bounds[i][0]-reach > bounds[j][2] || bounds[j][0]-reach > bounds[i][2] ||
+				bounds[i][1]-reach > bounds[j][3] || bounds[j][1]-reach > bounds[i][3] {
+				continue
+			}
+
+			a, b := polygons[ids[i]].Vertices, polygons[ids[j]].Vertices
+			dist, edgeA, edgeB := polygonDistance(a, b)
+			if dist > gap {
+				continue
+			}
+
+			uf.union(i, j)
+			if edgeA != nil && (dist > 0 || len(a) < 3 || len(b) < 3) {
+				bridges[i] = append(bridges[i], MonotoneChainHull([]*Point{edgeA[0], edgeA[1], edgeB[0], edgeB[1]}))
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	for i := range ids {
+		root := uf.find(i)
+		groups[root] = append(groups[root], i)
+	}
+
+	merged := make(map[int]*Polygon, len(groups))
+	for _, members := range groups {
+		first := polygons[ids[members[0]]]
+		if len(members) == 1 {
+			merged[ids[members[0]]] = first
+			continue
+		}
+
+		polygon := &Polygon{ClusterID: ids[members[0]]}
+		var rings [][]*Point
+		var vertices []*Point
+		for _, i := range members {
+			source := polygons[ids[i]]
+			polygon.NumPoints += source.NumPoints
+			polygon.MergedClusterIDs = append(polygon.MergedClusterIDs, source.sourceClusterIDs()...)
+			vertices = append(vertices, source.Vertices...)
+			if len(source.Vertices) >= 3 {
+				rings = append(rings, source.Vertices)
+			}
+
+			for _, bridge := range bridges[i] {
+				if len(bridge) >= 3 {
+					rings = append(rings, bridge)
+				}
+			}
+		}
+
+		sort.Ints(polygon.MergedClusterIDs)
+		polygon.Vertices = unionOutline(rings)
+		if !isSimplePolygon(polygon.Vertices) || !coversVertices(polygon.Vertices, vertices) {
+			polygon.Vertices = MonotoneChainHull(vertices)
+		}
+
+		merged[polygon.ClusterID] = polygon
+	}
+
+	return merged, nil
+}
+
+// sourceClusterIDs returns the clusters that the polygon was built from.
+func (p *Polygon) sourceClusterIDs() []int {
+	if p.MergedClusterIDs != nil {
+		return p.MergedClusterIDs
+	}
+
+	return []int{p.ClusterID}
+}
+
+// vertexBounds returns the inclusive bounding box of a set of points as min X, min Y, max X and
+// max Y.
+func vertexBounds(points []*Point) [4]int {
+	if len(points) == 0 {
+		return [4]int{math.MaxInt, math.MaxInt, math.MinInt, math.MinInt}
+	}
+
+	bounds := [4]int{points[0].X, points[0].Y, points[0].X, points[0].Y}
+	for _, point := range points {
+		bounds[0], bounds[1] = min(bounds[0], point.X), min(bounds[1], point.Y)
+		bounds[2], bounds[3] = max(bounds[2], point.X), max(bounds[3], point.Y)
+	}
+
+	return bounds
+}
+
+// polygonEdges returns the edges of a closed polygon. A single vertex is a zero length edge and
+// two vertices make a single edge.
+func polygonEdges(vertices []*Point) [][2]*Point {
+	switch len(vertices) {
+	case 0:
+		return nil
+	case 1:
+		return [][2]*Point{{vertices[0], vertices[0]}}
+	case 2:
+		return [][2]*Point{{vertices[0], vertices[1]}}
+	}
+
+	edges := make([][2]*Point, len(vertices))
+	for i, vertex := range vertices {
+		edges[i] = [2]*Point{vertex, vertices[(i+1)%len(vertices)]}
+	}
+
+	return edges
+}
+
+// polygonDistance returns the distance between two polygons along with their closest edges. The
+// distance is zero when their boundaries meet or one polygon holds the other, in which case no
+// edge is returned.
+func polygonDistance(a, b []*Point) (float64, *[2]*Point, *[2]*Point) {
+	edgesA, edgesB := polygonEdges(a), polygonEdges(b)
+	if len(edgesA) == 0 || len(edgesB) == 0 {
+		return math.Inf(1), nil, nil
+	}
+
+	dist := math.Inf(1)
+	var closestA, closestB *[2]*Point
+	for i := range edgesA {
+		for j := range edgesB {
+			u, v := edgesA[i], edgesB[j]
+			if segmentsIntersect(u[0], u[1], v[0], v[1]) {
+				return 0, &edgesA[i], &edgesB[j]
+			}
+
+			d := math.Min(math.Min(segmentDistance(u[0], v[0], v[1]), segmentDistance(u[1], v[0], v[1])),
+				math.Min(segmentDistance(v[0], u[0], u[1]), segmentDistance(v[1], u[0], u[1])))
+			if d < dist {
+				dist, closestA, closestB = d, &edgesA[i], &edgesB[j]
+			}
+		}
+	}
+
+	if (len(b) >= 3 && insidePolygon(b, a[0])) || (len(a) >= 3 && insidePolygon(a, b[0])) {
+		return 0, nil, nil
+	}
+
+	return dist, closestA, closestB
+}
+
+// unionOutline traces the outer boundary of the union of counter-clockwise rings. Edges are split
+// where they meet the edges of other rings, and the pieces with no ring on their right, which is
+// the outside of a counter-clockwise ring, make up the boundary. Vertices are rounded to the nearest
+// pixel.
+func unionOutline(rings [][]*Point) []*Point {
+	type piece struct {
+		from, to Point
+		used     bool
+	}
+
+	var pieces []*piece
+	seen := make(map[[4]int]bool)
+	for r, ring := range rings {
+		for _, edge := range polygonEdges(ring) {
+			splits := []float64{0, 1}
+			for o, other := range rings {
+				if o == r {
+					continue
+				}
+
+				for _, otherEdge := range polygonEdges(other) {
+					splits = append(splits, splitParams(edge[0], edge[1], otherEdge[0], otherEdge[1])...)
+				}
+			}
+			sort.Float64s(splits)
+
+			a, b := edge[0], edge[1]
+			dx, dy := float64(b.X-a.X), float64(b.Y-a.Y)
+			length := math.Hypot(dx, dy)
+			for k := 1; k < len(splits); k++ {
+				t0, t1 := splits[k-1], splits[k]
+				if t1-t0 < 1e-9 {
+					continue
+				}
+
+				// Look just outside of the ring, on the right of the piece.
+				tm := (t0 + t1) / 2
+				x, y := float64(a.X)+tm*dx+1e-4*dy/length, float64(a.Y)+tm*dy-1e-4*dx/length
+				covered := false
+				for o, other := range rings {
+					if o != r && containsPosition(other, x, y) {
+						covered = true
+						break
+					}
+				}
+
+				if covered {
+					continue
+				}
+
+				from := Point{X: int(math.Round(float64(a.X) + t0*dx)), Y: int(math.Round(float64(a.Y) + t0*dy))}
+				to := Point{X: int(math.Round(float64(a.X) + t1*dx)), Y: int(math.Round(float64(a.Y) + t1*dy))}
+				key := [4]int{from.X, from.Y, to.X, to.Y}
+				if from == to || seen[key] {
+					continue
+				}
+
+				seen[key] = true
+				pieces = append(pieces, &piece{from: from, to: to})
+			}
+		}
+	}
+
+	// Pieces that run both ways along the same segment are slivers that rounding closed.
+	outgoing := make(map[Point][]*piece)
+	var start *piece
+	for _, p := range pieces {
+		if seen[[4]int{p.to.X, p.to.Y, p.from.X, p.from.Y}] {
+			continue
+		}
+
+		outgoing[p.from] = append(outgoing[p.from], p)
+		if start == nil || p.from.X < start.from.X || (p.from.X == start.from.X && p.from.Y < start.from.Y) {
+			start = p
+		}
+	}
+
+	if start == nil {
+		return nil
+	}
+
+	// A counter-clockwise outline heads down at its lowest leftmost vertex. Taking the sharpest right
+	// turn at every junction keeps to the outside of the union.
+	var vertices []*Point
+	dirX, dirY := 0, -1
+	for at := start.from; len(vertices) <= len(pieces); {
+		var next *piece
+		bestTurn := math.Inf(1)
+		for _, p := range outgoing[at] {
+			if p.used {
+				continue
+			}
+
+			outX, outY := p.to.X-p.from.X, p.to.Y-p.from.Y
+			turn := math.Atan2(float64(dirX*outY-dirY*outX), float64(dirX*outX+dirY*outY))
+			if turn < bestTurn {
+				next, bestTurn = p, turn
+			}
+		}
+
+		if next == nil {
+			break
+		}
+
+		next.used = true
+		vertices = append(vertices, &Point{X: at.X, Y: at.Y})
+		dirX, dirY = next.to.X-next.from.X, next.to.Y-next.from.Y
+		if at = next.to; at == start.from {
+			return dropCollinear(vertices)
+		}
+	}
+
+	return nil
+}
+
+// splitParams returns the positions strictly inside segment ab, as fractions of its length, where
+// segment cd crosses, touches or overlaps it.
+func splitParams(a, b, c, d *Point) []float64 {
+	rx, ry := b.X-a.X, b.Y-a.Y
+	sx, sy := d.X-c.X, d.Y-c.Y
+	qx, qy := c.X-a.X, c.Y-a.Y
+
+	var params []float64
+	if denom := rx*sy - ry*sx; denom != 0 {
+		t := float64(qx*sy-qy*sx) / float64(denom)
+		u := float64(qx*ry-qy*rx) / float64(denom)
+		if 0 <= u && u <= 1 {
+			params = append(params, t)
+		}
+	} else if qx*ry-qy*rx == 0 && rx*rx+ry*ry > 0 {
+		lengthSq := float64(rx*rx + ry*ry)
+		params = append(params, float64(qx*rx+qy*ry)/lengthSq, float64((d.X-a.X)*rx+(d.Y-a.Y)*ry)/lengthSq)
+	}
+
+	inside := params[:0]
+	for _, t := range params {
+		if 0 < t && t < 1 {
+			inside = append(inside, t)
+		}
+	}
+
+	return inside
+}
+
+// containsPosition indicates whether a position lies inside a closed polygon with the even-odd
+// rule. Positions on the boundary may go either way.
+func containsPosition(vertices []*Point, x, y float64) bool {
+	inside := false
+	for i, j := 0, len(vertices)-1; i < len(vertices); j, i = i, i+1 {
+		a, b := vertices[j], vertices[i]
+		ay, by := float64(a.Y), float64(b.Y)
+		if (ay > y) != (by > y) {
+			crossX := float64(a.X) + (y-ay)*float64(b.X-a.X)/(by-ay)
+			if x < crossX {
+				inside = !inside
+			}
+		}
+	}
+
+	return inside
+}
+
+// coversVertices indicates whether every point lies inside a polygon or within a pixel of its
+// boundary, which allows for the rounding of its vertices.
+func coversVertices(vertices, points []*Point) bool {
+	if len(vertices) < 3 {
+		return false
+	}
+
+	for _, point := range points {
+		if insidePolygon(vertices, point) {
+			continue
+		}
+
+		covered := false
+		for _, edge := range polygonEdges(vertices) {
+			if segmentDistance(point, edge[0], edge[1]) <= 1 {
+				covered = true
+				break
+			}
+		}
+
+		if !covered {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,153 @@
+package annotate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// squarePolygon returns a counter-clockwise square keepout with its top-left corner at (x, y).
+func squarePolygon(clusterID, x, y, size int) *Polygon {
+	return &Polygon{
+		ClusterID: clusterID,
+		NumPoints: 4 * size,
+		Vertices: []*Point{{false, y, x}, {false, y, x + size}, {false, y + size, x + size},
+			{false, y + size, x}},
+	}
+}
+
+func TestUnionPolygons(t *testing.T) {
+	t.Run("Overlapping", func(t *testing.T) {
+		polygons := map[int]*Polygon{1: squarePolygon(1, 0, 0, 10), 2: squarePolygon(2, 5, 5, 10),
+			3: squarePolygon(3, 40, 40, 10)}
+		merged, err := UnionPolygons(polygons, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(merged) != 2 || merged[3] != polygons[3] {
+			t.Fatalf("expected the distant square to be left alone, got %v", merged)
+		}
+
+		union := merged[1]
+		if union.ClusterID != 1 || union.NumPoints != 80 || !reflect.DeepEqual(union.MergedClusterIDs, []int{1, 2}) {
+			t.Errorf("unexpected merged polygon metadata %+v", union)
+		}
+
+		if len(union.Vertices) != 8 || union.Area() != 175 || signedArea(union.Vertices) <= 0 {
+			t.Errorf("expected a counter-clockwise outline of area 175, got %v", union.Vertices)
+		}
+	})
+
+	t.Run("WithinGap", func(t *testing.T) {
+		polygons := map[int]*Polygon{4: squarePolygon(4, 0, 0, 10), 7: squarePolygon(7, 13, 0, 10)}
+		merged, err := UnionPolygons(polygons, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(merged) != 2 {
+			t.Errorf("expected squares 3 pixels apart to stay apart with a gap of 2, got %v", merged)
+		}
+
+		merged, err = UnionPolygons(polygons, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The bridge fills the space between the squares.
+		if len(merged) != 1 || merged[4].Area() != 230 || len(merged[4].Vertices) != 4 {
+			t.Errorf("expected a 23x10 rectangle, got %v", merged)
+		}
+
+		if !reflect.DeepEqual(merged[4].MergedClusterIDs, []int{4, 7}) {
+			t.Errorf("expected source clusters 4 and 7, got %v", merged[4].MergedClusterIDs)
+		}
+	})
+
+	t.Run("Contained", func(t *testing.T) {
+		polygons := map[int]*Polygon{1: squarePolygon(1, 0, 0, 20), 2: squarePolygon(2, 5, 5, 5),
+			3: {ClusterID: 3, NumPoints: 1, Vertices: []*Point{{false, 2, 2}}}}
+		merged, err := UnionPolygons(polygons, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(merged) != 1 || merged[1].Area() != 400 || !reflect.DeepEqual(merged[1].MergedClusterIDs, []int{1, 2, 3}) {
+			t.Errorf("expected the outer square to swallow the others, got %+v", merged[1])
+		}
+	})
+
+	t.Run("TouchingAtVertex", func(t *testing.T) {
+		polygons := map[int]*Polygon{1: squarePolygon(1, 0, 0, 10), 2: squarePolygon(2, 10, 10, 10)}
+		merged, err := UnionPolygons(polygons, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(merged) != 1 || !isSimplePolygon(merged[1].Vertices) {
+			t.Fatalf("expected a single simple polygon, got %v", merged)
+		}
+
+		for _, polygon := range polygons {
+			for _, vertex := range polygon.Vertices {
+				if !insidePolygon(merged[1].Vertices, vertex) {
+					t.Errorf("expected %v to be inside the merged polygon", vertex)
+				}
+			}
+		}
+	})
+
+	t.Run("RepeatedMerge", func(t *testing.T) {
+		polygons := map[int]*Polygon{1: squarePolygon(1, 0, 0, 10), 2: squarePolygon(2, 5, 5, 10)}
+		merged, err := UnionPolygons(polygons, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		merged[5] = squarePolygon(5, 12, 12, 10)
+		if merged, err = UnionPolygons(merged, 0); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(merged) != 1 || !reflect.DeepEqual(merged[1].MergedClusterIDs, []int{1, 2, 5}) {
+			t.Errorf("expected merged sources to carry over, got %v", merged[1].MergedClusterIDs)
+		}
+	})
+
+	t.Run("NegativeGap", func(t *testing.T) {
+		var paramErr ParameterError
+		if _, err := UnionPolygons(nil, -1); !errors.As(err, &paramErr) || paramErr.Name != "gap" {
+			t.Errorf("expected gap parameter error, got %v", err)
+		}
+	})
+}
+
+func TestPipelineMergePolygons(t *testing.T) {
+	opts := DefaultPipelineOptions()
+	opts.InflationDistance = 10
+	opts.MergePolygons = true
+	res, err := NewPipeline(opts).Run(squareImage(100, 30))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sources []int
+	for id, polygon := range res.Polygons {
+		if polygon.ClusterID != id {
+			t.Errorf("expected polygon to be keyed by its cluster ID %d, got %d", polygon.ClusterID, id)
+		}
+
+		sources = append(sources, polygon.sourceClusterIDs()...)
+	}
+
+	if len(sources) != len(res.Clusters) {
+		t.Errorf("expected every cluster to be the source of one polygon, got %v for %d clusters", sources,
+			len(res.Clusters))
+	}
+
+	opts.MergeCoordinates = MapCoordinates
+	if _, err := NewPipeline(opts).Run(squareImage(100, 30)); err == nil {
+		t.Error("expected a gap in metres to require a map")
+	}
+}
@@ -1,6 +1,7 @@
 package annotate
 
 import (
+	"image"
 	"image/color"
 	"math/rand"
 )
@@ -13,26 +14,34 @@ func RGBTo8BitGrayScaleIntensity(c color.Color) float64 {
 	return (0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)) / 257
 }
 
-func randomMat(row, col int) [][]float64 {
-	mat := make([][]float64, row)
-	for i := 0; i < row; i++ {
-		mat[i] = make([]float64, col)
-		for j := 0; j < col; j++ {
-			mat[i][j] = rand.Float64()
+// GrayScaleGrid converts an image into a grid of 8-bit gray scale intensity. The grid is indexed
+// from zero regardless of the bounds of the image.
+func GrayScaleGrid(img image.Image) *Grid {
+	bounds := img.Bounds()
+	grid := NewGrid(bounds.Dx(), bounds.Dy())
+	for i := 0; i < grid.Height; i++ {
+		for j := 0; j < grid.Width; j++ {
+			grid.Set(i, j, RGBTo8BitGrayScaleIntensity(img.At(bounds.Min.X+j, bounds.Min.Y+i)))
 		}
 	}
 
-	return mat
+	return grid
 }
 
-func onesMat(row, col int) [][]float64 {
-	mat := make([][]float64, row)
-	for i := 0; i < row; i++ {
-		mat[i] = make([]float64, col)
-		for j := 0; j < col; j++ {
-			mat[i][j] = 1.0
-		}
+func randomGrid(row, col int) *Grid {
+	grid := NewGrid(col, row)
+	for idx := range grid.Values {
+		grid.Values[idx] = rand.Float64()
+	}
+
+	return grid
+}
+
+func onesGrid(row, col int) *Grid {
+	grid := NewGrid(col, row)
+	for idx := range grid.Values {
+		grid.Values[idx] = 1.0
 	}
 
-	return mat
+	return grid
 }
@@ -1 +1,3 @@
 module github.com/calvinfeng/autoko
+
+go 1.21
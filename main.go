@@ -1,39 +1,435 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"image"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/calvinfeng/autoko/annotate"
 )
 
+// Output formats
+const (
+	formatPNG     = "png"
+	formatGeoJSON = "geojson"
+	formatCSV     = "csv"
+	formatJSON    = "json"
+)
+
+// Exit codes
+const (
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// command is a subcommand of the CLI. Every command runs the pipeline until its stage and writes the
+// images of the listed stages.
+type command struct {
+	Name        string
+	Description string
+	Stage       annotate.Stage
+	Images      []annotate.Stage
+}
+
+var commands = []*command{
+	{"floodfill", "remove the exterior wall with flood fill", annotate.StageFloodFill,
+		[]annotate.Stage{annotate.StageFloodFill}},
+	{"morphology", "apply morphological operations to obstacles", annotate.StageMorphology,
+		[]annotate.Stage{annotate.StageMorphology}},
+	{"blur", "apply Gaussian blur", annotate.StageGaussianBlur,
+		[]annotate.Stage{annotate.StageGaussianBlur}},
+	{"edges", "detect edges", annotate.StageEdgeDetection,
+		[]annotate.Stage{annotate.StageEdgeDetection}},
+	{"cluster", "cluster edges into obstacles", annotate.StageClustering,
+		[]annotate.Stage{annotate.StageClustering}},
+	{"hull", "compute keepout polygons", annotate.StageConvexHull,
+		[]annotate.Stage{annotate.StageConvexHull}},
+	{"run", "run every stage and write every output", annotate.StageConvexHull,
+		[]annotate.Stage{annotate.StageFloodFill, annotate.StageMorphology, annotate.StageGaussianBlur,
+			annotate.StageEdgeDetection, annotate.StageClustering, annotate.StageConvexHull}},
+}
+
+// imageSuffixes are the file name suffixes of stage images.
+var imageSuffixes = map[annotate.Stage]string{
+	annotate.StageFloodFill:     "flood_fill",
+	annotate.StageMorphology:    "morphology",
+	annotate.StageGaussianBlur:  "gaussian_blur",
+	annotate.StageEdgeDetection: "edge_detection",
+	annotate.StageClustering:    "clustering",
+	annotate.StageConvexHull:    "convex_hull",
+}
+
+// usageError is returned when the command line is invalid.
+type usageError struct {
+	Message string
+}
+
+func (u usageError) Error() string {
+	return u.Message
+}
+
+var errInvalidFlags = errors.New("invalid flags")
+
 func main() {
-	mapName := "microsoft"
+	err := run(os.Args[1:])
+	if err == nil {
+		return
+	}
+
+	// The flag package has already reported the problem.
+	if err == flag.ErrHelp {
+		return
+	}
+
+	if err == errInvalidFlags {
+		os.Exit(exitUsage)
+	}
+
+	fmt.Fprintln(os.Stderr, "Error:", err)
+
+	var uErr usageError
+	if errors.As(err, &uErr) {
+		printUsage()
+		os.Exit(exitUsage)
+	}
+
+	var paramErr annotate.ParameterError
+	if errors.As(err, &paramErr) {
+		os.Exit(exitUsage)
+	}
+
+	os.Exit(exitFailure)
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: autoko <command> [flags]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.Name, cmd.Description)
+	}
+	fmt.Fprintln(os.Stderr, "\nRun 'autoko <command> -h' to list the flags of a command.")
+}
+
+func run(args []string) error {
+	if len(args) == 0 {
+		return usageError{"missing command"}
+	}
+
+	var cmd *command
+	for _, c := range commands {
+		if c.Name == args[0] {
+			cmd = c
+		}
+	}
+
+	if cmd == nil {
+		return usageError{fmt.Sprintf("unknown command %s", args[0])}
+	}
+
+	defaultFormat := formatPNG
+	if cmd.Name == "run" {
+		defaultFormat = formatPNG + "," + formatGeoJSON
+	}
+
+	opts := annotate.DefaultPipelineOptions()
+	flags := flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+	input := flags.String("input", "", "input map, an image (PNG, PGM) or a map_server YAML file")
+	outputDir := flags.String("output", "results", "output directory")
+	format := flags.String("format", defaultFormat,
+		"comma separated output formats: png, geojson, and csv or json for cluster statistics")
+	coordinates := flags.String("coordinates", "",
+		"GeoJSON coordinates, pixel or map (default map for YAML input and pixel otherwise)")
+	flags.IntVar(&opts.FloodFillNeighborDist, "neighbor-dist", opts.FloodFillNeighborDist,
+		"flood fill dilation distance in pixels")
+	flags.StringVar(&opts.FloodFillMatchMode, "match-mode", opts.FloodFillMatchMode,
+		"flood fill match, relative or absolute within -tolerance of the seed, or range from -min-value to -max-value")
+	flags.Float64Var(&opts.FloodFillTolerance, "tolerance", opts.FloodFillTolerance,
+		"flood fill intensity tolerance, a fraction of the seed intensity in relative mode")
+	flags.Float64Var(&opts.FloodFillMinVal, "min-value", opts.FloodFillMinVal,
+		"lowest intensity flood fill grows through in range mode")
+	flags.Float64Var(&opts.FloodFillMaxVal, "max-value", opts.FloodFillMaxVal,
+		"highest intensity flood fill grows through in range mode")
+	flags.StringVar(&opts.FloodFillSeedMode, "seed-mode", opts.FloodFillSeedMode,
+		"flood fill seeds, top-left, border for every border pixel matching -exterior-value, or coordinates from -seed")
+	flags.Float64Var(&opts.FloodFillExteriorVal, "exterior-value", opts.FloodFillExteriorVal,
+		"intensity of exterior space in border seed mode")
+	flags.Var((*seedList)(&opts.FloodFillSeeds), "seed",
+		"flood fill seed as row,column in coordinates seed mode, repeat the flag for several seeds")
+	flags.BoolVar(&opts.FloodFillScanline, "scanline", opts.FloodFillScanline,
+		"use the bounded memory scanline flood fill, which does not jump over gaps narrower than -neighbor-dist")
+	morphology := flags.String("morphology", "",
+		"comma separated operations on obstacles after flood fill: dilate, erode, open or close")
+	flags.StringVar(&opts.MorphologyElement, "morphology-element", opts.MorphologyElement,
+		"morphology structuring element: square, cross or disk")
+	flags.IntVar(&opts.MorphologyRadius, "morphology-radius", opts.MorphologyRadius,
+		"morphology structuring element radius in pixels")
+	flags.IntVar(&opts.GaussianKernelSize, "kernel-size", opts.GaussianKernelSize,
+		"Gaussian kernel size, must be odd")
+	flags.Float64Var(&opts.GaussianSigma, "sigma", opts.GaussianSigma,
+		"Gaussian kernel standard deviation in pixels, 0 uses the built-in 5x5 kernel")
+	flags.BoolVar(&opts.SeparableConvolution, "separable", opts.SeparableConvolution,
+		"use separable convolution for Gaussian blur and Sobel operators, requires -sigma")
+	border := flags.String("border", string(opts.Border),
+		"convolution border mode: zero, replicate, reflect or wrap")
+	flags.IntVar(&opts.NumRoutines, "routines", opts.NumRoutines,
+		"number of go routines for Gaussian blur and gradient")
+	flags.StringVar(&opts.EdgeThresholdMode, "threshold-mode", opts.EdgeThresholdMode,
+		"edge threshold mode, single, hysteresis, auto-median or auto-otsu")
+	flags.Float64Var(&opts.EdgeThreshold, "threshold", opts.EdgeThreshold,
+		"minimum gradient magnitude of an edge in single threshold mode")
+	flags.Float64Var(&opts.EdgeLowThreshold, "low-threshold", opts.EdgeLowThreshold,
+		"weak edge gradient magnitude in hysteresis mode")
+	flags.Float64Var(&opts.EdgeHighThreshold, "high-threshold", opts.EdgeHighThreshold,
+		"strong edge gradient magnitude in hysteresis mode")
+	flags.Float64Var(&opts.EdgeAutoSigma, "auto-sigma", opts.EdgeAutoSigma,
+		"spread of the thresholds around the median gradient magnitude in auto-median mode")
+	flags.IntVar(&opts.ClusterNeighborRange, "cluster-range", opts.ClusterNeighborRange,
+		"maximum pixel distance between edges of a cluster in nearest-neighbor mode")
+	flags.StringVar(&opts.ClusterMode, "cluster-mode", opts.ClusterMode,
+		"clustering algorithm, nearest-neighbor or dbscan")
+	flags.Float64Var(&opts.ClusterEps, "cluster-eps", opts.ClusterEps,
+		"neighborhood radius in pixels in dbscan mode")
+	flags.IntVar(&opts.ClusterMinPoints, "cluster-min-points", opts.ClusterMinPoints,
+		"minimum number of edges within -cluster-eps of a core edge in dbscan mode")
+	filter := &opts.ClusterFilter
+	flags.IntVar(&filter.MinPixels, "filter-min-pixels", filter.MinPixels,
+		"minimum number of edges of a cluster, 0 disables the limit")
+	flags.IntVar(&filter.MaxPixels, "filter-max-pixels", filter.MaxPixels,
+		"maximum number of edges of a cluster, 0 disables the limit")
+	flags.Float64Var(&filter.MinArea, "filter-min-area", filter.MinArea,
+		"minimum convex hull area of a cluster, 0 disables the limit")
+	flags.Float64Var(&filter.MaxArea, "filter-max-area", filter.MaxArea,
+		"maximum convex hull area of a cluster, 0 disables the limit")
+	flags.Float64Var(&filter.MinExtent, "filter-min-extent", filter.MinExtent,
+		"minimum longer bounding box side of a cluster, 0 disables the limit")
+	flags.Float64Var(&filter.MaxExtent, "filter-max-extent", filter.MaxExtent,
+		"maximum longer bounding box side of a cluster, 0 disables the limit")
+	flags.Float64Var(&filter.MaxAspectRatio, "filter-max-aspect-ratio", filter.MaxAspectRatio,
+		"maximum ratio of the bounding box sides of a cluster, 0 disables the limit")
+	flags.StringVar(&filter.Coordinates, "filter-coordinates", filter.Coordinates,
+		"unit of the filter limits, pixel or map for metres, map requires YAML input")
+	flags.Float64Var(&filter.MergeDistance, "filter-merge-distance", filter.MergeDistance,
+		"distance within which a cluster below a minimum merges into the nearest kept cluster, 0 drops it")
+	flags.StringVar(&opts.HullMode, "hull-mode", opts.HullMode, "keepout polygon, convex, concave or rectangle")
+	flags.Float64Var(&opts.HullConcavity, "hull-concavity", opts.HullConcavity,
+		"concave hull concavity, 1 follows clusters the closest and larger values approach the convex hull")
+	flags.Float64Var(&opts.HullLengthThreshold, "hull-length-threshold", opts.HullLengthThreshold,
+		"concave hull edges shorter than this many pixels are kept")
+	flags.Float64Var(&opts.InflationDistance, "inflation-distance", opts.InflationDistance,
+		"distance keepout polygons are offset outward by, such as the robot inscribed radius, 0 disables it")
+	flags.StringVar(&opts.InflationCoordinates, "inflation-coordinates", opts.InflationCoordinates,
+		"unit of the inflation distance, pixel or map for metres, map requires YAML input")
+	flags.StringVar(&opts.InflationJoin, "inflation-join", opts.InflationJoin,
+		"corners of inflated keepout polygons, miter or round")
+	flags.BoolVar(&opts.MergePolygons, "merge", opts.MergePolygons,
+		"merge keepout polygons that overlap or lie within -merge-gap of each other")
+	flags.Float64Var(&opts.MergeGap, "merge-gap", opts.MergeGap, "distance within which keepout polygons are merged")
+	flags.StringVar(&opts.MergeCoordinates, "merge-coordinates", opts.MergeCoordinates,
+		"unit of the merge gap, pixel or map for metres, map requires YAML input")
+	flags.Float64Var(&opts.SimplifyTolerance, "simplify-tolerance", opts.SimplifyTolerance,
+		"pixel distance within which keepout polygon vertices are dropped, 0 keeps them")
+	flags.IntVar(&opts.SimplifyMaxVertices, "simplify-max-vertices", opts.SimplifyMaxVertices,
+		"maximum number of vertices of a keepout polygon, at least 4, 0 disables the limit")
+	if err := flags.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return err
+		}
+
+		return errInvalidFlags
+	}
+
+	opts.Border = annotate.BorderMode(*border)
+	if *morphology != "" {
+		for _, operation := range strings.Split(*morphology, ",") {
+			opts.Morphology = append(opts.Morphology, strings.TrimSpace(operation))
+		}
+	}
+	if *input == "" {
+		return usageError{"missing -input"}
+	}
+
+	formats := make(map[string]bool)
+	for _, f := range strings.Split(*format, ",") {
+		f = strings.TrimSpace(f)
+		if f != formatPNG && f != formatGeoJSON && f != formatCSV && f != formatJSON {
+			return usageError{fmt.Sprintf("unsupported format %s", f)}
+		}
+
+		formats[f] = true
+	}
+
+	if formats[formatGeoJSON] && cmd.Stage != annotate.StageConvexHull {
+		return usageError{fmt.Sprintf("command %s does not produce keepout polygons for GeoJSON", cmd.Name)}
+	}
 
-	reader, err := os.Open(fmt.Sprintf("maps/%s.png", mapName))
+	if (formats[formatCSV] || formats[formatJSON]) && cmd.Stage < annotate.StageClustering {
+		return usageError{fmt.Sprintf("command %s does not produce clusters for statistics", cmd.Name)}
+	}
+
+	start := time.Now()
+	name, res, err := runPipeline(*input, annotate.NewPipeline(opts), cmd.Stage)
 	if err != nil {
-		fmt.Println("Error", err)
+		return err
+	}
+	fmt.Printf("Pipeline took %v to complete\n", time.Since(start))
+	if cmd.Stage >= annotate.StageEdgeDetection {
+		fmt.Printf("Applied edge thresholds low %.2f and high %.2f\n", res.EdgeLowThreshold, res.EdgeHighThreshold)
+	}
+
+	if err := os.MkdirAll(*outputDir, 0755); err != nil {
+		return err
+	}
+
+	if formats[formatPNG] {
+		for _, stage := range cmd.Images {
+			filename := filepath.Join(*outputDir, fmt.Sprintf("%s_%s.png", name, imageSuffixes[stage]))
+			if err := annotate.WritePNG(filename, drawStage(res, stage)); err != nil {
+				return err
+			}
+			fmt.Printf("Wrote %s\n", filename)
+		}
 	}
 
+	if formats[formatGeoJSON] {
+		if *coordinates == "" {
+			*coordinates = annotate.PixelCoordinates
+			if res.Frame != nil {
+				*coordinates = annotate.MapCoordinates
+			}
+		}
+
+		fc, err := annotate.KeepoutFeatureCollection(res, name, *coordinates)
+		if err != nil {
+			return err
+		}
+
+		filename := filepath.Join(*outputDir, fmt.Sprintf("%s_keepouts.geojson", name))
+		if err := writeGeoJSON(filename, fc); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s\n", filename)
+	}
+
+	for _, f := range []string{formatCSV, formatJSON} {
+		if !formats[f] {
+			continue
+		}
+
+		filename := filepath.Join(*outputDir, fmt.Sprintf("%s_clusters.%s", name, f))
+		if err := writeClusterStats(filename, res.ClusterStats, f); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s\n", filename)
+	}
+
+	return nil
+}
+
+// seedList is a repeatable flag of flood fill seeds given as row,column.
+type seedList []*annotate.Coordinate
+
+func (s *seedList) String() string {
+	var seeds []string
+	for _, c := range *s {
+		seeds = append(seeds, fmt.Sprintf("%d,%d", c.I, c.J))
+	}
+
+	return strings.Join(seeds, " ")
+}
+
+func (s *seedList) Set(val string) error {
+	var c annotate.Coordinate
+	if _, err := fmt.Sscanf(val, "%d,%d", &c.I, &c.J); err != nil {
+		return fmt.Errorf("seed %q must be row,column", val)
+	}
+
+	*s = append(*s, &c)
+	return nil
+}
+
+// runPipeline loads the input and runs the pipeline until the given stage. Map server YAML files
+// carry their map frame into the result.
+func runPipeline(input string, p *annotate.Pipeline, last annotate.Stage) (string, *annotate.PipelineResult, error) {
+	ext := strings.ToLower(filepath.Ext(input))
+	name := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	if ext == ".yaml" || ext == ".yml" {
+		m, err := annotate.LoadMap(input)
+		if err != nil {
+			return "", nil, err
+		}
+
+		fmt.Printf("Successfully loaded map %s with resolution %v\n", m.Name, m.Frame.Resolution)
+		res, err := p.RunMapUntil(m, last)
+		return m.Name, res, err
+	}
+
+	reader, err := os.Open(input)
+	if err != nil {
+		return "", nil, err
+	}
 	defer reader.Close()
 
-	img, _, decodeErr := image.Decode(reader)
-	if decodeErr != nil {
-		fmt.Println("Decoding has error", decodeErr)
-	} else {
-		fmt.Printf("Successfully decoded %s\n", mapName)
-		fmt.Printf("Loaded image has the following dimension: %v\n", img.Bounds())
+	img, _, err := image.Decode(reader)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode %s: %w", input, err)
+	}
+
+	fmt.Printf("Successfully decoded %s with dimension %v\n", name, img.Bounds())
+	res, err := p.RunUntil(img, last)
+	return name, res, err
+}
+
+func drawStage(res *annotate.PipelineResult, stage annotate.Stage) image.Image {
+	switch stage {
+	case annotate.StageFloodFill:
+		return annotate.DrawGrayScale(res.Bounds, res.WallRemoved)
+	case annotate.StageMorphology:
+		return annotate.DrawGrayScale(res.Bounds, res.Morphed)
+	case annotate.StageGaussianBlur:
+		return annotate.DrawGrayScale(res.Bounds, res.Blurred)
+	case annotate.StageEdgeDetection:
+		return annotate.DrawEdges(res)
+	case annotate.StageClustering:
+		return annotate.DrawClusters(res)
+	default:
+		return annotate.DrawHulls(res)
+	}
+}
+
+func writeClusterStats(filename string, report *annotate.ClusterStatsReport, format string) error {
+	outputFile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	encode := report.EncodeJSON
+	if format == formatCSV {
+		encode = report.EncodeCSV
+	}
+
+	if err := encode(outputFile); err != nil {
+		outputFile.Close()
+		return fmt.Errorf("failed to encode %s: %w", filename, err)
+	}
+
+	return outputFile.Close()
+}
 
-		start := time.Now()
-		// annotate.CreateFloodFillImage("maps", mapName, img)
-		// annotate.CreateGaussianBlurImage("maps", mapName, img)
-		// annotate.CreateEdgeDetectionImage("maps", mapName, img)
-		// annotate.CreateClusteringImage("maps", mapName, img)
-		annotate.CreateConvexHullImage("maps", mapName, img)
-		end := time.Now()
+func writeGeoJSON(filename string, fc *annotate.FeatureCollection) error {
+	outputFile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
 
-		fmt.Printf("Algorithm took %v to complete \n", end.Sub(start))
+	if err := fc.Encode(outputFile); err != nil {
+		outputFile.Close()
+		return fmt.Errorf("failed to encode %s: %w", filename, err)
 	}
+
+	return outputFile.Close()
 }